@@ -1,3 +1,5 @@
 module github.com/jessesomerville/semigraph
 
 go 1.24.5
+
+require golang.org/x/image v0.25.0
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	semigraph "github.com/jessesomerville/semigraph/src"
+)
+
+// imageExts are the extensions of the files rendered from a directory.
+var imageExts = []string{
+	".apng", ".bmp", ".ff", ".gif", ".jpeg", ".jpg", ".pbm", ".pgm", ".png",
+	".pnm", ".ppm", ".qoi", ".tif", ".tiff", ".webp", ".y4m",
+}
+
+// input is a file, URL or stdin to render, or the error finding it.
+type input struct {
+	name string
+	err  error
+}
+
+// expandInputs expands the arguments into the inputs to render, in order.
+// Directories are replaced by the images in them, sorted by name, and glob
+// patterns the shell didn't expand are expanded.
+func expandInputs(args []string) []input {
+	var inputs []input
+	for _, arg := range args {
+		if arg == "-" || isURL(arg) {
+			inputs = append(inputs, input{name: arg})
+			continue
+		}
+		paths := []string{arg}
+		if _, err := os.Stat(arg); err != nil && strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil || len(matches) == 0 {
+				inputs = append(inputs, input{name: arg, err: fmt.Errorf("no files match %q", arg)})
+				continue
+			}
+			paths = matches
+		}
+		for _, p := range paths {
+			inputs = append(inputs, expandDir(p)...)
+		}
+	}
+	return inputs
+}
+
+// expandDir returns the images in path if it is a directory, or path
+// itself if it isn't.
+func expandDir(path string) []input {
+	fi, err := os.Stat(path)
+	if err != nil || !fi.IsDir() {
+		// Any error is reported when the file is opened.
+		return []input{{name: path}}
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return []input{{name: path, err: err}}
+	}
+	var inputs []input
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if slices.Contains(imageExts, strings.ToLower(filepath.Ext(name))) {
+			inputs = append(inputs, input{name: filepath.Join(path, name)})
+		}
+	}
+	if len(inputs) == 0 {
+		return []input{{name: path, err: fmt.Errorf("no images in directory")}}
+	}
+	return inputs
+}
+
+// httpClient fetches the URL inputs. The timeout covers reading the whole
+// image, so a server that stops sending doesn't hang the render.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// sortInputs sorts the inputs by key: name, size or mtime. Stdin, URLs
+// and inputs that can't be found are left at the end in their original
+// order.
+func sortInputs(inputs []input, key string) error {
+	var by func(a, b os.FileInfo) int
+	switch key {
+	case "none":
+		return nil
+	case "name":
+		by = func(a, b os.FileInfo) int { return 0 }
+	case "size":
+		by = func(a, b os.FileInfo) int { return cmp.Compare(a.Size(), b.Size()) }
+	case "mtime":
+		by = func(a, b os.FileInfo) int { return a.ModTime().Compare(b.ModTime()) }
+	default:
+		return fmt.Errorf("unknown sort key %q", key)
+	}
+	infos := make(map[string]os.FileInfo)
+	for _, in := range inputs {
+		if in.err == nil && in.name != "-" && !isURL(in.name) {
+			if fi, err := os.Stat(in.name); err == nil {
+				infos[in.name] = fi
+			}
+		}
+	}
+	slices.SortStableFunc(inputs, func(a, b input) int {
+		fa, fb := infos[a.name], infos[b.name]
+		switch {
+		case fa == nil && fb == nil:
+			return 0
+		case fa == nil:
+			// Inputs that aren't files go last.
+			return 1
+		case fb == nil:
+			return -1
+		}
+		if c := by(fa, fb); c != 0 {
+			return c
+		}
+		return strings.Compare(a.name, b.name)
+	})
+	return nil
+}
+
+// openInput opens the file, URL or stdin named by name.
+func openInput(name string) (io.ReadCloser, error) {
+	switch {
+	case name == "-":
+		return io.NopCloser(os.Stdin), nil
+	case isURL(name):
+		resp, err := httpClient.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			// An error page isn't the image, even if it decodes as one.
+			resp.Body.Close()
+			return nil, fmt.Errorf("fetching image: %s", resp.Status)
+		}
+		return resp.Body, nil
+	}
+	return os.Open(name)
+}
+
+// renderInput renders the file, URL or stdin named by name.
+func renderInput(name string, opts *semigraph.RenderOptions) error {
+	in, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return render(in, opts)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFiles creates the files in dir with the given contents, making the
+// directories they are in.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// inputNames returns the names of the inputs, with a "!" after those that
+// have an error.
+func inputNames(inputs []input) []string {
+	var names []string
+	for _, in := range inputs {
+		if in.err != nil {
+			names = append(names, in.name+"!")
+		} else {
+			names = append(names, in.name)
+		}
+	}
+	return names
+}
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.png":            "",
+		"b.GIF":            "",
+		"notes.txt":        "",
+		"sub/d.jpg":        "",
+		"sub/c.webp":       "",
+		"sub/readme.md":    "",
+		"sub/.hidden.png":  "",
+		"sub/deeper/e.png": "",
+		"docs/f.txt":       "",
+	})
+	t.Chdir(dir)
+
+	testCases := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "files",
+			args: []string{"notes.txt", "missing.png", "a.png"},
+			// Files are passed through as given, and any error is
+			// reported when they are opened.
+			want: []string{"notes.txt", "missing.png", "a.png"},
+		},
+		{
+			name: "stdin_and_urls",
+			args: []string{"-", "https://example.com/*.png"},
+			want: []string{"-", "https://example.com/*.png"},
+		},
+		{
+			name: "glob",
+			args: []string{"*.png", "[ab].*"},
+			want: []string{"a.png", "a.png", "b.GIF"},
+		},
+		{
+			name: "glob_no_matches",
+			args: []string{"*.bmp"},
+			want: []string{"*.bmp!"},
+		},
+		{
+			name: "directory",
+			args: []string{"sub"},
+			// Subdirectories, hidden files and files that aren't images
+			// are skipped.
+			want: []string{filepath.Join("sub", "c.webp"), filepath.Join("sub", "d.jpg")},
+		},
+		{
+			name: "directory_without_images",
+			args: []string{"docs"},
+			want: []string{"docs!"},
+		},
+		{
+			name: "failing_input_among_good_ones",
+			args: []string{"a.png", "*.bmp", "docs", "sub/deeper"},
+			want: []string{"a.png", "*.bmp!", "docs!", filepath.Join("sub", "deeper", "e.png")},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := inputNames(expandInputs(tc.args))
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("expandInputs(%q) = %q, want %q", tc.args, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSortInputs(t *testing.T) {
+	dir := t.TempDir()
+	// The names, sizes and modification times are each in a different
+	// order.
+	writeFiles(t, dir, map[string]string{
+		"a.png": "aaa",
+		"b.png": "b",
+		"c.png": "cc",
+	})
+	t.Chdir(dir)
+	now := time.Now()
+	for name, age := range map[string]time.Duration{"a.png": 3, "b.png": 1, "c.png": 2} {
+		mtime := now.Add(-age * time.Hour)
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		key  string
+		want []string
+	}{
+		{key: "none", want: []string{"c.png", "-", "a.png", "missing.png", "b.png", "bad.png!"}},
+		// Inputs that aren't files are left at the end in their order.
+		{key: "name", want: []string{"a.png", "b.png", "c.png", "-", "missing.png", "bad.png!"}},
+		{key: "size", want: []string{"b.png", "c.png", "a.png", "-", "missing.png", "bad.png!"}},
+		{key: "mtime", want: []string{"a.png", "c.png", "b.png", "-", "missing.png", "bad.png!"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.key, func(t *testing.T) {
+			inputs := []input{
+				{name: "c.png"},
+				{name: "-"},
+				{name: "a.png"},
+				{name: "missing.png"},
+				{name: "b.png"},
+				{name: "bad.png", err: os.ErrNotExist},
+			}
+			if err := sortInputs(inputs, tc.key); err != nil {
+				t.Fatalf("sortInputs(%q) returned unexpected error: %v", tc.key, err)
+			}
+			if got := inputNames(inputs); !slices.Equal(got, tc.want) {
+				t.Errorf("sortInputs(%q) = %q, want %q", tc.key, got, tc.want)
+			}
+		})
+	}
+
+	if err := sortInputs(nil, "color"); err == nil {
+		t.Error(`sortInputs("color") returned nil error`)
+	}
+}
+
+func TestOpenInputURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/image.png" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "image data")
+	}))
+	defer srv.Close()
+
+	in, err := openInput(srv.URL + "/image.png")
+	if err != nil {
+		t.Fatalf("openInput() returned unexpected error: %v", err)
+	}
+	data, err := io.ReadAll(in)
+	in.Close()
+	if err != nil || string(data) != "image data" {
+		t.Errorf("openInput() read %q, %v, want %q", data, err, "image data")
+	}
+
+	if in, err := openInput(srv.URL + "/missing.png"); err == nil {
+		in.Close()
+		t.Error("openInput() of a missing URL returned nil error")
+	} else if !strings.Contains(err.Error(), "404") {
+		t.Errorf("openInput() of a missing URL returned %v, want the status", err)
+	}
+}
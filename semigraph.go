@@ -2,33 +2,138 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"image"
+	"image/draw"
 	"image/gif"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"strings"
+	"sync"
+	"time"
 
 	_ "image/jpeg"
 	_ "image/png"
 
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+
 	semigraph "github.com/jessesomerville/semigraph/src"
+	_ "github.com/jessesomerville/semigraph/src/formats"
 )
 
 var (
 	cpuprof = flag.String("cpuprof", "", "write a CPU profile to `file`")
 	memprof = flag.String("memprof", "", "write a memory profile to `file`")
 	noprint = flag.Bool("noprint", false, "render the input but don't output the results")
+	glyphs  = flag.String("glyphs", "auto", "draw cells using `set`: auto, octant, sextant, quadrant, half or braille")
+	cols    = flag.Int("cols", 0, "scale the output to at most `n` columns")
+	rows    = flag.Int("rows", 0, "scale the output to at most `n` rows")
+	fit     = flag.Bool("fit", false, "scale the output to fit the terminal")
+	aspect  = flag.Float64("aspect", 2, "the `ratio` of a terminal cell's height to its width")
+	kernel  = flag.String("resample", "box", "scale using `kernel`: nearest, box, bilinear or lanczos")
+	colors  = flag.String("colors", "auto", "limit output to `profile`: auto, truecolor, 256, 16, 8 or mono")
+	dither  = flag.String("dither", "none", "dither limited colors using `method`: none, bayer2, bayer4, bayer8, bluenoise, floyd-steinberg, atkinson or sierra")
+	backend = flag.String("backend", "auto", "draw images using `protocol`: auto, text, sixel, kitty or iterm")
+	quant   = flag.String("quantize", "median", "split cells between two colors using `method`: median or optimal")
+	workers = flag.Int("workers", runtime.NumCPU(), "render on `n` goroutines")
+	speed   = flag.Float64("speed", 1, "play GIFs `x` times faster")
+	rawSize = flag.String("raw", "", "read raw rgb24 video frames of `WxH` pixels, as written by ffmpeg -f rawvideo -pix_fmt rgb24")
+	fps     = flag.Float64("fps", 25, "the frame `rate` of raw video")
+	names   = flag.Bool("names", false, "print the name of each input above it")
+	bg      = flag.String("bg", "none", "composite transparent pixels onto `background`: none, checker, terminal or a hex color")
+	sortBy  = flag.String("sort", "none", "sort the inputs by `key`: none, name, size or mtime")
+
+	gallery     = flag.Bool("gallery", false, "lay the inputs out in a grid of thumbnails with their names")
+	galleryCols = flag.Int("gallery-cols", 0, "put `n` thumbnails in each row of the gallery, or as many as fit in the terminal")
+	thumbSize   = flag.String("thumb", "24x12", "draw gallery thumbnails in `WxH` cells")
+	padding     = flag.Int("padding", 2, "leave `n` columns between gallery thumbnails")
+	animate     = flag.Bool("animate", false, "play animations in place in the gallery instead of showing their first frame")
+
+	output   = flag.String("o", "", "export the render to `file` instead of printing it, as PNG, SVG or HTML by its extension")
+	cellSize = flag.String("cell", "8x16", "the size in pixels of a cell in `WxH` when exporting PNG or SVG")
+	ansiIn   = flag.Bool("ansi", false, "read the input as text with ANSI colors, such as a saved render, when exporting")
+
+	detectOnly    = flag.Bool("detect", false, "print the detected capabilities of the terminal and exit")
+	probe         = flag.Bool("probe", false, "with -glyphs auto, check which glyphs the terminal draws one cell wide, remembering the answer for terminals that report their version")
+	detectTimeout = flag.Duration("detect-timeout", 200*time.Millisecond, "wait at most `duration` for the terminal to answer capability queries, or 0 to only check the environment")
 )
 
+var resamplers = map[string]semigraph.Resample{
+	"nearest":  semigraph.ResampleNearest,
+	"box":      semigraph.ResampleBox,
+	"bilinear": semigraph.ResampleBilinear,
+	"lanczos":  semigraph.ResampleLanczos,
+}
+
+var profiles = map[string]semigraph.ColorProfile{
+	"truecolor": semigraph.TrueColor,
+	"256":       semigraph.ANSI256,
+	"16":        semigraph.ANSI16,
+	"8":         semigraph.ANSI8,
+	"mono":      semigraph.Monochrome,
+}
+
+// backends draw images with a terminal graphics protocol instead of text.
+var backends = map[string]func(io.Writer, image.Image, *semigraph.RenderOptions) error{
+	"sixel": semigraph.RenderSixel,
+	"iterm": semigraph.RenderITerm,
+	"kitty": func(w io.Writer, img image.Image, opts *semigraph.RenderOptions) error {
+		return newKitty().Render(w, img, opts)
+	},
+}
+
+// animators play animations with a graphics protocol that can animate
+// images itself. Other backends only draw the first frame.
+var animators = map[string]func(io.Writer, semigraph.FrameSource, *semigraph.RenderOptions) error{
+	"kitty": func(w io.Writer, src semigraph.FrameSource, opts *semigraph.RenderOptions) error {
+		return newKitty().RenderFrames(w, src, opts)
+	},
+}
+
+// newKitty returns a kitty graphics encoder for a new image. Inside tmux,
+// images are placed with placeholders passed through to the terminal.
+func newKitty() *semigraph.Kitty {
+	tmux := os.Getenv("TMUX") != ""
+	return &semigraph.Kitty{Placeholder: tmux, Tmux: tmux}
+}
+
+var quantizers = map[string]semigraph.Quantizer{
+	"median":  semigraph.QuantizeMedian,
+	"optimal": semigraph.QuantizeOptimal,
+}
+
+var dithers = map[string]semigraph.Dither{
+	"none":            semigraph.DitherNone,
+	"bayer2":          semigraph.DitherBayer2,
+	"bayer4":          semigraph.DitherBayer4,
+	"bayer8":          semigraph.DitherBayer8,
+	"bluenoise":       semigraph.DitherBlueNoise,
+	"floyd-steinberg": semigraph.DitherFloydSteinberg,
+	"atkinson":        semigraph.DitherAtkinson,
+	"sierra":          semigraph.DitherSierra,
+}
+
 func main() {
 	flag.Parse()
+	if !run() {
+		os.Exit(1)
+	}
+}
 
+// run renders the inputs and reports whether they all succeeded.
+func run() bool {
 	if *cpuprof != "" {
 		f, err := os.Create(*cpuprof)
 		if err != nil {
@@ -41,46 +146,112 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
-	inPath := flag.Arg(0)
-	if inPath == "" {
-		fatalf("usage: semigraph <input_path>")
+	var caps semigraph.Capabilities
+	if *detectOnly || *glyphs == "auto" || *colors == "auto" || *backend == "auto" {
+		caps = detectTerminal()
+	}
+	if *probe && *glyphs == "auto" && caps.Name != "none" {
+		// If the probe fails, the detected glyph set is still a good guess.
+		if gs, err := semigraph.ProbeGlyphs(caps.ID(), *detectTimeout); err != nil {
+			fmt.Fprintf(os.Stderr, "semigraph: probing glyphs: %v\n", err)
+		} else {
+			caps.Glyphs = gs
+		}
+	}
+	if *detectOnly {
+		printCapabilities(caps)
+		return true
+	}
+	if flag.NArg() == 0 {
+		fatalf("usage: semigraph <input_path | url | directory | ->...")
+	}
+	if *glyphs == "auto" {
+		*glyphs = caps.Glyphs.Name
+	}
+	if *backend == "auto" {
+		*backend = caps.Protocol.String()
 	}
 
-	data, err := os.ReadFile(inPath)
+	opts := &semigraph.RenderOptions{
+		Glyphs:      semigraph.LookupGlyphSet(*glyphs),
+		Columns:     *cols,
+		Rows:        *rows,
+		FitTerminal: *fit,
+		CellAspect:  *aspect,
+		Workers:     *workers,
+	}
+	if opts.Glyphs == nil {
+		fatalf("semigraph: unknown glyph set %q", *glyphs)
+	}
+	resample, ok := resamplers[*kernel]
+	if !ok {
+		fatalf("semigraph: unknown resampling kernel %q", *kernel)
+	}
+	opts.Resample = resample
+	profile, ok := profiles[*colors]
+	if *colors == "auto" {
+		profile, ok = caps.Profile, true
+	}
+	if !ok {
+		fatalf("semigraph: unknown color profile %q", *colors)
+	}
+	opts.Profile = profile
+	dm, ok := dithers[*dither]
+	if !ok {
+		fatalf("semigraph: unknown dither method %q", *dither)
+	}
+	opts.Dither = dm
+	q, ok := quantizers[*quant]
+	if !ok {
+		fatalf("semigraph: unknown quantizer %q", *quant)
+	}
+	opts.Quantizer = q
+	if _, ok := backends[*backend]; !ok && *backend != "text" {
+		fatalf("semigraph: unknown backend %q", *backend)
+	}
+	background, err := parseBackground(*bg)
 	if err != nil {
 		fatalf("semigraph: %v", err)
 	}
+	opts.Background = background
 
-	_, format, err := image.DecodeConfig(bytes.NewReader(data))
-	if err != nil {
+	inputs := expandInputs(flag.Args())
+	if err := sortInputs(inputs, *sortBy); err != nil {
 		fatalf("semigraph: %v", err)
 	}
-
-	switch format {
-	case "gif":
-		g, err := gif.DecodeAll(bytes.NewReader(data))
-		if err != nil {
-			fatalf("semigraph: %v", err)
+	if *output != "" {
+		if len(inputs) != 1 || *gallery {
+			fatalf("semigraph: -o takes exactly one input")
 		}
-		gg, err := semigraph.RenderGIF(g)
-		if err != nil {
-			fatalf("semigraph: %v", err)
+		if err := export(inputs[0], opts); err != nil {
+			fmt.Fprintf(os.Stderr, "semigraph: %s: %v\n", inputs[0].name, err)
+			return false
 		}
-		if !*noprint {
-			stop := gg.Play()
-			c := make(chan os.Signal, 1)
-			signal.Notify(c, os.Interrupt)
-			<-c
-			stop()
+		return true
+	}
+	if *ansiIn {
+		fatalf("semigraph: -ansi needs -o")
+	}
+
+	failed := false
+	if *gallery {
+		failed = !renderGallery(inputs, opts)
+		inputs = nil
+	}
+	for i, in := range inputs {
+		if *names {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s:\n", in.name)
 		}
-	case "png", "jpeg":
-		input, _, err := image.Decode(bytes.NewReader(data))
-		if err != nil {
-			fatalf("semigraph: %v", err)
+		err := in.err
+		if err == nil {
+			err = renderInput(in.name, opts)
 		}
-		out := semigraph.Render(input)
-		if !*noprint {
-			fmt.Println(out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "semigraph: %s: %v\n", in.name, err)
+			failed = true
 		}
 	}
 
@@ -95,6 +266,401 @@ func main() {
 			log.Fatal("could not write memory profile: ", err)
 		}
 	}
+	return !failed
+}
+
+// render renders the image, animation or video read from in.
+func render(in io.Reader, opts *semigraph.RenderOptions) error {
+	img, src, err := decode(in)
+	if err != nil {
+		return err
+	}
+	w := io.Writer(os.Stdout)
+	if *noprint {
+		w = io.Discard
+	}
+	if animate, ok := animators[*backend]; ok && src != nil {
+		if err := animate(w, src, opts); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+		return nil
+	}
+	if draw, ok := backends[*backend]; ok {
+		// Only the first frame of animations is drawn.
+		if src != nil {
+			if img, err = firstFrame(src); err != nil {
+				return err
+			}
+		}
+		if err := draw(w, img, opts); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+		return nil
+	}
+	if src != nil {
+		return play(src, opts)
+	}
+	if err := semigraph.NewRenderer(opts).RenderTo(w, img); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+	return nil
+}
+
+// decode reads an image from in, or the frames of an animation or video.
+func decode(in io.Reader) (image.Image, semigraph.FrameSource, error) {
+	if *rawSize != "" {
+		var w, h int
+		if _, err := fmt.Sscanf(*rawSize, "%dx%d", &w, &h); err != nil {
+			return nil, nil, fmt.Errorf("invalid video size %q", *rawSize)
+		}
+		src, err := semigraph.NewRawVideoSource(bufio.NewReader(in), w, h, *fps)
+		return nil, src, err
+	}
+
+	// Video is read as it is played, since it can be far larger than the
+	// images read whole below, or never end.
+	br := bufio.NewReader(in)
+	if magic, _ := br.Peek(9); string(magic) == "YUV4MPEG2" {
+		src, err := semigraph.NewY4MSource(br)
+		return nil, src, err
+	}
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, nil, errors.New("unrecognized image format, expected PNG, APNG, JPEG, GIF, BMP, TIFF, WebP, Netpbm, QOI, farbfeld or Y4M")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	switch format {
+	case "gif":
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, err
+		}
+		src, err := semigraph.NewGIFSource(g)
+		return nil, src, err
+	case "png", "webp":
+		decodeAnim := semigraph.DecodeAPNG
+		if format == "webp" {
+			decodeAnim = semigraph.DecodeWebP
+		}
+		src, err := decodeAnim(bytes.NewReader(data))
+		if err == nil {
+			return nil, src, nil
+		}
+		if !errors.Is(err, semigraph.ErrNotAnimated) {
+			return nil, nil, err
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, nil, err
+}
+
+// renderGallery renders the inputs as a gallery of thumbnails and reports
+// whether they all succeeded. Inputs that fail to decode are left out, and
+// those that fail to render are shown blank.
+func renderGallery(inputs []input, opts *semigraph.RenderOptions) bool {
+	gopts := &semigraph.GalleryOptions{
+		Columns: *galleryCols,
+		Padding: *padding,
+		Animate: *animate,
+		Render:  opts,
+	}
+	if _, err := fmt.Sscanf(*thumbSize, "%dx%d", &gopts.CellColumns, &gopts.CellRows); err != nil {
+		fatalf("semigraph: invalid thumbnail size %q", *thumbSize)
+	}
+	failed := false
+	var items []semigraph.GalleryItem
+	for _, in := range inputs {
+		item, err := galleryItem(in)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "semigraph: %s: %v\n", in.name, err)
+			failed = true
+			continue
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return false
+	}
+	g, err := semigraph.RenderGallery(items, gopts)
+	if err != nil {
+		// The items that failed are reported, one per line, and left blank
+		// in the gallery.
+		fmt.Fprintln(os.Stderr, err)
+		failed = true
+	}
+	if g == nil {
+		return false
+	}
+	if g.NumFrames() > 1 {
+		if err := playGIF(g); err != nil {
+			fmt.Fprintf(os.Stderr, "semigraph: %v\n", err)
+			return false
+		}
+		return !failed
+	}
+	if !*noprint {
+		out, _ := g.RenderFrame(0)
+		fmt.Println(out)
+	}
+	return !failed
+}
+
+// galleryItem decodes the input into a gallery item captioned with its
+// name.
+func galleryItem(in input) (semigraph.GalleryItem, error) {
+	item := semigraph.GalleryItem{Caption: filepath.Base(in.name)}
+	if in.err != nil {
+		return item, in.err
+	}
+	r, err := openInput(in.name)
+	if err != nil {
+		return item, err
+	}
+	defer r.Close()
+	item.Image, item.Frames, err = decode(r)
+	return item, err
+}
+
+// export renders the input and writes it to the output file in the format
+// named by its extension.
+func export(in input, opts *semigraph.RenderOptions) error {
+	var cw, ch int
+	if _, err := fmt.Sscanf(*cellSize, "%dx%d", &cw, &ch); err != nil {
+		return fmt.Errorf("invalid cell size %q", *cellSize)
+	}
+	if in.err != nil {
+		return in.err
+	}
+	r, err := openInput(in.name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var grid *semigraph.Grid
+	if *ansiIn {
+		grid, err = semigraph.ParseANSI(r, opts.Glyphs)
+	} else {
+		img, src, derr := decode(r)
+		if derr != nil {
+			return derr
+		}
+		if src != nil {
+			// Export the first frame of animations.
+			if img, err = firstFrame(src); err != nil {
+				return err
+			}
+		}
+		grid, err = semigraph.NewRenderer(opts).RenderGrid(img)
+	}
+	if err != nil {
+		return err
+	}
+
+	var write func(io.Writer) error
+	switch strings.ToLower(filepath.Ext(*output)) {
+	case ".png":
+		write = func(w io.Writer) error { return grid.WritePNG(w, cw, ch) }
+	case ".svg":
+		write = func(w io.Writer) error { return grid.WriteSVG(w, cw, ch) }
+	case ".html", ".htm":
+		write = grid.WriteHTML
+	default:
+		return fmt.Errorf("unknown export format %q, expected .png, .svg or .html", filepath.Ext(*output))
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	return errors.Join(err, f.Close())
+}
+
+// firstFrame returns the first frame of src drawn onto its canvas.
+func firstFrame(src semigraph.FrameSource) (image.Image, error) {
+	f, err := src.NextFrame()
+	if err != nil {
+		return nil, err
+	}
+	w, h := src.Size()
+	canvas := image.NewRGBA(image.Rect(0, 0, w, h))
+	if f.Background != nil {
+		draw.Draw(canvas, canvas.Bounds(), image.NewUniform(f.Background), image.Point{}, draw.Src)
+	}
+	draw.Draw(canvas, f.Image.Bounds(), f.Image, f.Image.Bounds().Min, f.Op)
+	return canvas, nil
+}
+
+// play renders the frames from src and plays them until they end or the
+// user interrupts playback.
+func play(src semigraph.FrameSource, opts *semigraph.RenderOptions) error {
+	// Frames shown once, like video, are played as they are rendered so
+	// they don't all have to fit in memory. Animations that loop are
+	// rendered up front to play every loop from memory.
+	if src.LoopCount() < 0 && !*noprint {
+		return playWith(func(ctx context.Context) *semigraph.Player {
+			return semigraph.PlayFrames(ctx, os.Stdout, src, opts, nil)
+		})
+	}
+	g, err := semigraph.RenderFrames(src, opts)
+	if err != nil {
+		return err
+	}
+	return playGIF(g)
+}
+
+// playGIF plays g until it ends or the user interrupts playback.
+func playGIF(g *semigraph.GIF) error {
+	if *noprint {
+		return nil
+	}
+	return playWith(g.Play)
+}
+
+// playWith plays what start starts playing until it ends or the user
+// interrupts playback.
+func playWith(start func(context.Context) *semigraph.Player) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	p := start(ctx)
+	p.SetSpeed(*speed)
+	// Control playback from the keyboard if stdin is a terminal.
+	if restore, err := semigraph.MakeRaw(os.Stdin); err == nil {
+		defer restore()
+		r, w := io.Pipe()
+		keys.attach(w)
+		defer keys.detach()
+		go p.HandleKeys(r)
+	}
+	<-p.Done()
+	return p.Err()
+}
+
+// keys forwards what is typed on stdin to the player that is playing.
+// Stdin is read by a single goroutine for the whole run, since a read
+// can't be interrupted and one left behind by a finished player would
+// take the next player's keys.
+var keys keyForwarder
+
+type keyForwarder struct {
+	start sync.Once
+	mu    sync.Mutex
+	w     *io.PipeWriter // The current player's keys, or nil if none.
+}
+
+// attach sends the keys read from stdin to w until detach is called,
+// starting to read stdin the first time it is called.
+func (k *keyForwarder) attach(w *io.PipeWriter) {
+	k.mu.Lock()
+	k.w = w
+	k.mu.Unlock()
+	k.start.Do(func() { go k.forward() })
+}
+
+// detach stops sending keys to the writer passed to attach and closes it.
+// Keys typed while no player is attached are dropped.
+func (k *keyForwarder) detach() {
+	k.mu.Lock()
+	w := k.w
+	k.w = nil
+	k.mu.Unlock()
+	if w != nil {
+		w.Close()
+	}
+}
+
+func (k *keyForwarder) forward() {
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		k.mu.Lock()
+		w := k.w
+		k.mu.Unlock()
+		// Writing blocks until the player reads the keys, or fails once it
+		// is detached.
+		if w != nil && n > 0 {
+			w.Write(buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// detectTerminal returns the capabilities of the terminal that standard
+// output is written to. If it is written elsewhere, such as to a file, it
+// is assumed to be shown later by a terminal that can display anything.
+func detectTerminal() semigraph.Capabilities {
+	fi, err := os.Stdout.Stat()
+	if *output != "" || err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return semigraph.Capabilities{
+			Name:     "none",
+			Profile:  semigraph.TrueColor,
+			Glyphs:   semigraph.Octants,
+			Protocol: semigraph.ProtocolText,
+		}
+	}
+	caps, err := semigraph.DetectTerminal(*detectTimeout)
+	if err != nil && *detectOnly {
+		// Otherwise the environment is a good enough guess to go on with.
+		fmt.Fprintf(os.Stderr, "semigraph: only the environment was checked: %v\n", err)
+	}
+	return caps
+}
+
+// printCapabilities prints caps in the form of the flags that select them.
+func printCapabilities(caps semigraph.Capabilities) {
+	colors := ""
+	for name, p := range profiles {
+		if p == caps.Profile {
+			colors = name
+		}
+	}
+	fmt.Printf("terminal:    %s\n", caps.Name)
+	if caps.Multiplexer != "" {
+		fmt.Printf("multiplexer: %s\n", caps.Multiplexer)
+	}
+	fmt.Printf("colors:      %s\n", colors)
+	fmt.Printf("glyphs:      %s\n", caps.Glyphs.Name)
+	fmt.Printf("backend:     %s\n", caps.Protocol)
+	if caps.Attributes != nil {
+		fmt.Printf("attributes:  %v\n", caps.Attributes)
+	}
+	if caps.Secondary != nil {
+		fmt.Printf("secondary:   %v\n", caps.Secondary)
+	}
+}
+
+// parseBackground returns the background named by s.
+func parseBackground(s string) (semigraph.Background, error) {
+	switch s {
+	case "none":
+		return nil, nil
+	case "checker":
+		return semigraph.Checkerboard(8, semigraph.RGB(0xcc, 0xcc, 0xcc), semigraph.RGB(0x99, 0x99, 0x99)), nil
+	case "terminal":
+		c, err := semigraph.QueryBackground(time.Second)
+		if err != nil {
+			return nil, err
+		}
+		return semigraph.SolidBackground(c), nil
+	}
+	c, err := semigraph.ParseHexColor(s)
+	if err != nil {
+		return nil, err
+	}
+	return semigraph.SolidBackground(c), nil
 }
 
 func fatalf(format string, args ...any) {
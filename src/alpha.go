@@ -0,0 +1,89 @@
+package semigraph
+
+// A Background is drawn behind partially transparent pixels.
+type Background interface {
+	// At returns the opaque color of the background at (x, y) in the
+	// coordinates of the image being rendered.
+	At(x, y int) Color
+}
+
+// SolidBackground returns a background that is c everywhere.
+func SolidBackground(c Color) Background {
+	return solidBackground(c)
+}
+
+type solidBackground Color
+
+func (b solidBackground) At(_, _ int) Color {
+	return Color(b)
+}
+
+// Checkerboard returns a background of size x size pixel squares
+// alternating between a and b, starting with a at the origin.
+func Checkerboard(size int, a, b Color) Background {
+	return checkerboard{size: max(size, 1), a: a, b: b}
+}
+
+type checkerboard struct {
+	size int
+	a, b Color
+}
+
+func (c checkerboard) At(x, y int) Color {
+	// Floor the division so the pattern continues into negative coordinates.
+	fx, fy := x/c.size, y/c.size
+	if x < 0 && x%c.size != 0 {
+		fx--
+	}
+	if y < 0 && y%c.size != 0 {
+		fy--
+	}
+	if (fx+fy)%2 == 0 {
+		return c.a
+	}
+	return c.b
+}
+
+// compositor resolves the alpha channel of the pixels in an image.
+//
+// Pixels are alpha blended onto bg in sRGB, the same way browsers and
+// image editors show them. If bg is nil, pixels that are at least half
+// opaque keep their own color and the rest are transparent, so the
+// terminal's background shows through.
+type compositor struct {
+	bg Background
+}
+
+// premultiplied returns the color of a pixel at (x, y) whose channels have
+// already been multiplied by its alpha.
+func (c compositor) premultiplied(x, y int, r, g, b, a uint8) Color {
+	switch a {
+	case 0x00:
+		return c.straight(x, y, 0, 0, 0, 0)
+	case 0xff:
+		return RGB(r, g, b)
+	}
+	div := func(v uint8) uint8 {
+		return uint8(min((uint32(v)*0xff+uint32(a)/2)/uint32(a), 0xff))
+	}
+	return c.straight(x, y, div(r), div(g), div(b), a)
+}
+
+// straight returns the color of a pixel at (x, y) whose channels have not
+// been multiplied by its alpha.
+func (c compositor) straight(x, y int, r, g, b, a uint8) Color {
+	if a == 0xff {
+		return RGB(r, g, b)
+	}
+	if c.bg == nil {
+		if a < 0x80 {
+			return Transparent
+		}
+		return RGB(r, g, b)
+	}
+	bg := c.bg.At(x, y)
+	blend := func(fg, bg uint8) uint8 {
+		return uint8((uint32(fg)*uint32(a) + uint32(bg)*uint32(0xff-a) + 0x7f) / 0xff)
+	}
+	return RGB(blend(r, bg.R), blend(g, bg.G), blend(b, bg.B))
+}
@@ -0,0 +1,161 @@
+package semigraph
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCompositor(t *testing.T) {
+	testCases := []struct {
+		name       string
+		bg         Background
+		r, g, b, a uint8
+		want       Color
+	}{
+		{
+			name: "opaque",
+			bg:   SolidBackground(RGB(0, 0, 255)),
+			r:    0xff, a: 0xff,
+			want: RGB(0xff, 0, 0),
+		},
+		{
+			name: "no_background_mostly_transparent",
+			r:    0xff, a: 0x7f,
+			want: Transparent,
+		},
+		{
+			name: "no_background_mostly_opaque",
+			r:    0xff, g: 0x80, a: 0x80,
+			want: RGB(0xff, 0x80, 0),
+		},
+		{
+			name: "solid",
+			bg:   SolidBackground(RGB(0, 0, 0xff)),
+			r:    0xff, a: 0x80,
+			want: RGB(0x80, 0, 0x7f),
+		},
+		{
+			name: "solid_transparent",
+			bg:   SolidBackground(RGB(0, 0, 0xff)),
+			r:    0xff,
+			want: RGB(0, 0, 0xff),
+		},
+		{
+			name: "checkerboard",
+			bg:   Checkerboard(8, RGB(0xff, 0xff, 0xff), RGB(0, 0, 0)),
+			a:    0x00,
+			want: RGB(0xff, 0xff, 0xff),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := compositor{bg: tc.bg}.straight(0, 0, tc.r, tc.g, tc.b, tc.a)
+			if got != tc.want {
+				t.Errorf("straight(%d, %d, %d, %d) = %v, want %v", tc.r, tc.g, tc.b, tc.a, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckerboard(t *testing.T) {
+	a, b := RGB(1, 1, 1), RGB(2, 2, 2)
+	bg := Checkerboard(2, a, b)
+	testCases := []struct {
+		x, y int
+		want Color
+	}{
+		{0, 0, a},
+		{1, 1, a},
+		{2, 0, b},
+		{2, 2, a},
+		{-1, 0, b},
+		{-2, -2, a},
+		{-3, 0, a},
+	}
+	for _, tc := range testCases {
+		if got := bg.At(tc.x, tc.y); got != tc.want {
+			t.Errorf("At(%d, %d) = %v, want %v", tc.x, tc.y, got, tc.want)
+		}
+	}
+}
+
+func TestRenderTransparency(t *testing.T) {
+	red := color.RGBA{0xff, 0x00, 0x00, 0xff}
+	halfWhite := color.NRGBA{0xff, 0xff, 0xff, 0x80}
+	leftRed := drawFn(2, 4, func(x, _ int) color.Color {
+		if x == 0 {
+			return red
+		}
+		return color.Transparent
+	})
+	redThenClear := drawFn(4, 4, func(x, _ int) color.Color {
+		if x < 2 {
+			return red
+		}
+		return color.Transparent
+	})
+	// A cell with only a foreground after one with a background.
+	redThenLeftGreen := drawFn(4, 4, func(x, _ int) color.Color {
+		switch {
+		case x < 2:
+			return red
+		case x == 2:
+			return color.RGBA{0x00, 0xff, 0x00, 0xff}
+		}
+		return color.Transparent
+	})
+	faded := image.NewNRGBA(image.Rect(0, 0, 2, 4))
+	for y := range 4 {
+		for x := range 2 {
+			faded.SetNRGBA(x, y, halfWhite)
+		}
+	}
+	testCases := []struct {
+		name  string
+		input image.Image
+		opts  *RenderOptions
+		want  string
+	}{
+		{
+			name:  "transparent_mask",
+			input: leftRed,
+			want:  "\x1b[38;5;196m▌\x1b[m",
+		},
+		{
+			name:  "reset_background",
+			input: redThenLeftGreen,
+			want:  "\x1b[48;5;196m \x1b[49m\x1b[38;5;46m▌\x1b[m",
+		},
+		{
+			name:  "reset_after_color",
+			input: redThenClear,
+			want:  "\x1b[48;5;196m \x1b[m ",
+		},
+		{
+			name:  "no_background",
+			input: faded,
+			want:  "\x1b[48;5;231m \x1b[m",
+		},
+		{
+			name:  "solid_background",
+			input: faded,
+			opts:  &RenderOptions{Background: SolidBackground(RGB(0, 0, 0))},
+			want:  "\x1b[48;2;128;128;128m \x1b[m",
+		},
+		{
+			name:  "checkerboard_background",
+			input: faded,
+			opts:  &RenderOptions{Background: Checkerboard(1, RGB(0, 0, 0), RGB(0xff, 0xff, 0xff))},
+			want:  "\x1b[48;5;231;38;2;128;128;128m\U0001cd89\x1b[m",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := render(t, tc.input, tc.opts)
+			if got != tc.want {
+				t.Errorf("Render(img) returned unexpected result:\ngot:  %q\nwant: %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package semigraph
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseANSI reads text drawn with the characters of gs and SGR color
+// sequences, such as the output of [Render], and returns the cells it
+// draws. If gs is nil, [Octants] is used.
+//
+// The 8-bit, 24-bit and 16 color codes are understood, as are resets and
+// reverse video. Other escape sequences are skipped. Characters that
+// aren't in gs are kept with an empty mask, so they stand for their
+// background color. Rows shorter than the longest are padded with
+// transparent spaces.
+func ParseANSI(r io.Reader, gs *GlyphSet) (*Grid, error) {
+	if gs == nil {
+		gs = Octants
+	}
+	p := &ansiParser{r: bufio.NewReader(r), fg: Transparent, bg: Transparent}
+	var rows [][]Cell
+	var row []Cell
+	for {
+		ch, _, err := p.r.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case ch == '\x1b':
+			if err := p.escape(); err != nil {
+				return nil, err
+			}
+		case ch == '\n':
+			rows = append(rows, row)
+			row = nil
+		case ch < ' ' || ch == 0x7f:
+			// Other control characters don't draw anything.
+		default:
+			mask, _ := gs.Mask(ch)
+			fg, bg := p.fg, p.bg
+			if p.reverse {
+				fg, bg = bg, fg
+			}
+			row = append(row, Cell{Rune: ch, FG: fg, BG: bg, Mask: mask})
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	g := &Grid{Rows: len(rows), Glyphs: gs}
+	for _, row := range rows {
+		g.Cols = max(g.Cols, len(row))
+	}
+	g.Cells = make([]Cell, 0, g.Cols*g.Rows)
+	blank := Cell{Rune: ' ', FG: Transparent, BG: Transparent}
+	for _, row := range rows {
+		g.Cells = append(g.Cells, row...)
+		for range g.Cols - len(row) {
+			g.Cells = append(g.Cells, blank)
+		}
+	}
+	return g, nil
+}
+
+// ansiParser is the state of the terminal while parsing.
+type ansiParser struct {
+	r       *bufio.Reader
+	fg, bg  Color
+	reverse bool
+}
+
+var errTruncated = errors.New("semigraph: truncated escape sequence")
+
+// escape reads the escape sequence after an ESC and applies it if it sets
+// colors.
+func (p *ansiParser) escape() error {
+	b, err := p.r.ReadByte()
+	if err != nil {
+		return errTruncated
+	}
+	switch b {
+	case '[':
+		// A CSI sequence is parameter bytes followed by a final byte.
+		var params []byte
+		for {
+			c, err := p.r.ReadByte()
+			if err != nil {
+				return errTruncated
+			}
+			if c >= 0x40 && c <= 0x7e {
+				if c == 'm' {
+					return p.sgr(string(params))
+				}
+				return nil
+			}
+			params = append(params, c)
+		}
+	case ']':
+		// An OSC sequence ends with BEL or ST.
+		for {
+			c, err := p.r.ReadByte()
+			if err != nil {
+				return errTruncated
+			}
+			if c == '\a' {
+				return nil
+			}
+			if c == '\x1b' {
+				_, err := p.r.ReadByte()
+				if err != nil {
+					return errTruncated
+				}
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// sgr applies the Select Graphic Rendition parameters.
+func (p *ansiParser) sgr(params string) error {
+	codes := make([]int, 0, 8)
+	for _, s := range strings.Split(params, ";") {
+		if s == "" {
+			codes = append(codes, 0)
+			continue
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("semigraph: invalid SGR sequence %q", params)
+		}
+		codes = append(codes, v)
+	}
+	for i := 0; i < len(codes); i++ {
+		switch c := codes[i]; {
+		case c == 0:
+			p.fg, p.bg, p.reverse = Transparent, Transparent, false
+		case c == 7:
+			p.reverse = true
+		case c == 27:
+			p.reverse = false
+		case c >= 30 && c <= 37:
+			p.fg = xterm256[c-30]
+		case c >= 90 && c <= 97:
+			p.fg = xterm256[c-90+8]
+		case c >= 40 && c <= 47:
+			p.bg = xterm256[c-40]
+		case c >= 100 && c <= 107:
+			p.bg = xterm256[c-100+8]
+		case c == 39:
+			p.fg = Transparent
+		case c == 49:
+			p.bg = Transparent
+		case c == 38 || c == 48:
+			col, n, ok := extendedColor(codes[i+1:])
+			if !ok {
+				return fmt.Errorf("semigraph: invalid SGR sequence %q", params)
+			}
+			if c == 38 {
+				p.fg = col
+			} else {
+				p.bg = col
+			}
+			i += n
+		}
+	}
+	return nil
+}
+
+// extendedColor parses the 5;n or 2;r;g;b color after a 38 or 48 code and
+// returns it with the number of codes it used.
+func extendedColor(codes []int) (Color, int, bool) {
+	valid := func(vs []int) bool {
+		for _, v := range vs {
+			if v < 0 || v > 255 {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case len(codes) >= 2 && codes[0] == 5 && valid(codes[1:2]):
+		return xterm256[codes[1]], 2, true
+	case len(codes) >= 4 && codes[0] == 2 && valid(codes[1:4]):
+		return RGB(uint8(codes[1]), uint8(codes[2]), uint8(codes[3])), 4, true
+	}
+	return Color{}, 0, false
+}
@@ -0,0 +1,119 @@
+package semigraph
+
+import (
+	"image/color"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseANSI(t *testing.T) {
+	red, blue := RGB(0xff, 0, 0), RGB(0x12, 0x34, 0x56)
+	none := Cell{Rune: ' ', FG: Transparent, BG: Transparent}
+	testCases := []struct {
+		name     string
+		in       string
+		wantCols int
+		want     []Cell
+	}{
+		{
+			name:     "truecolor",
+			in:       "\x1b[48;2;18;52;86;38;5;196m▌\x1b[m",
+			wantCols: 1,
+			want:     []Cell{{Rune: '▌', FG: red, BG: blue, Mask: 0b01010101}},
+		},
+		{
+			name:     "ansi16",
+			in:       "\x1b[44;91m▀\x1b[49m \x1b[m",
+			wantCols: 2,
+			want: []Cell{
+				{Rune: '▀', FG: xterm256[9], BG: xterm256[4], Mask: 0b00001111},
+				{Rune: ' ', FG: xterm256[9], BG: Transparent},
+			},
+		},
+		{
+			name:     "reverse",
+			in:       "\x1b[7;38;5;196m█\x1b[27m█",
+			wantCols: 2,
+			want: []Cell{
+				{Rune: '█', FG: Transparent, BG: red, Mask: 0xff},
+				{Rune: '█', FG: red, BG: Transparent, Mask: 0xff},
+			},
+		},
+		{
+			name:     "padded_rows",
+			in:       "\x1b[48;5;196m  \x1b[m\nab\x1b[2K\x1b]0;title\a\r\n",
+			wantCols: 2,
+			want: []Cell{
+				{Rune: ' ', FG: Transparent, BG: red},
+				{Rune: ' ', FG: Transparent, BG: red},
+				{Rune: 'a', FG: Transparent, BG: Transparent},
+				{Rune: 'b', FG: Transparent, BG: Transparent},
+			},
+		},
+		{
+			name:     "blank_line",
+			in:       "a\n\nb",
+			wantCols: 1,
+			want:     []Cell{{Rune: 'a', FG: Transparent, BG: Transparent}, none, {Rune: 'b', FG: Transparent, BG: Transparent}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g, err := ParseANSI(strings.NewReader(tc.in), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g.Cols != tc.wantCols || !slices.Equal(g.Cells, tc.want) {
+				t.Errorf("ParseANSI(%q) = %d cols %v, want %d cols %v", tc.in, g.Cols, g.Cells, tc.wantCols, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseANSIErrors(t *testing.T) {
+	for _, in := range []string{
+		"\x1b[38;5m ",
+		"\x1b[48;2;1;2;300m ",
+		"\x1b[38;7m ",
+		"\x1b[48;5;1",
+	} {
+		if _, err := ParseANSI(strings.NewReader(in), nil); err == nil {
+			t.Errorf("ParseANSI(%q) returned nil error", in)
+		}
+	}
+}
+
+func TestParseANSIRoundTrip(t *testing.T) {
+	// Every cell is split evenly between two colors, so it is drawn
+	// exactly.
+	input := drawFn(12, 12, func(x, y int) color.Color {
+		switch {
+		case (x+y)%2 == 0:
+			return color.RGBA{0xff, 0x00, 0x00, 0xff}
+		case x >= 6:
+			return color.Transparent
+		}
+		return color.RGBA{0x00, 0x00, 0xff, 0xff}
+	})
+	for _, gs := range glyphSets {
+		t.Run(gs.Name, func(t *testing.T) {
+			out := render(t, input, &RenderOptions{Glyphs: gs})
+			g, err := ParseANSI(strings.NewReader(out), gs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := g.Image()
+			if !got.Bounds().Eq(input.Bounds()) {
+				t.Fatalf("Image() bounds = %v, want %v", got.Bounds(), input.Bounds())
+			}
+			for y := range 12 {
+				for x := range 12 {
+					if got.RGBAAt(x, y) != input.RGBAAt(x, y) {
+						t.Errorf("pixel (%d, %d) = %v, want %v", x, y, got.RGBAAt(x, y), input.RGBAAt(x, y))
+					}
+				}
+			}
+		})
+	}
+}
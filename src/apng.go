@@ -0,0 +1,259 @@
+package semigraph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"time"
+)
+
+// ErrNotAnimated is returned by [DecodeAPNG] and [DecodeWebP] for an image
+// that only has a single still frame.
+var ErrNotAnimated = errors.New("semigraph: image isn't animated")
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// apngSource is a FrameSource for the frames of an animated PNG.
+type apngSource struct {
+	width, height int
+	plays         int
+
+	// header is the IHDR chunk's data, and ancillary holds the encoded
+	// chunks before the image data that every frame shares, like PLTE and
+	// tRNS.
+	header    []byte
+	ancillary []byte
+
+	frames []apngFrame
+	next   int
+}
+
+// apngFrame is a frame control chunk and the image data that follows it.
+type apngFrame struct {
+	width, height int
+	x, y          int
+	delay         time.Duration
+	dispose, op   byte
+	data          []byte
+}
+
+// DecodeAPNG reads an animated PNG from r and returns a [FrameSource] for
+// its frames. Each frame is decoded with [png.Decode] when it is read.
+//
+// It returns [ErrNotAnimated] if the PNG doesn't have an animation control
+// chunk.
+func DecodeAPNG(r io.Reader) (FrameSource, error) {
+	br := bufio.NewReader(r)
+	sig := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(br, sig); err != nil || string(sig) != pngSignature {
+		return nil, errors.New("semigraph: not a PNG file")
+	}
+	s := &apngSource{}
+	animated := false
+	seenData := false
+	var cur *apngFrame
+	for {
+		typ, data, err := readChunk(br)
+		if err != nil {
+			return nil, fmt.Errorf("semigraph: reading PNG: %w", err)
+		}
+		switch typ {
+		case "IHDR":
+			if len(data) != 13 {
+				return nil, errors.New("semigraph: invalid PNG header")
+			}
+			s.header = data
+			s.width = int(binary.BigEndian.Uint32(data[0:4]))
+			s.height = int(binary.BigEndian.Uint32(data[4:8]))
+		case "acTL":
+			if len(data) != 8 {
+				return nil, errors.New("semigraph: invalid APNG animation control chunk")
+			}
+			animated = true
+			s.plays = int(binary.BigEndian.Uint32(data[4:8]))
+		case "fcTL":
+			f, err := s.parseFrameControl(data)
+			if err != nil {
+				return nil, err
+			}
+			s.frames = append(s.frames, f)
+			cur = &s.frames[len(s.frames)-1]
+		case "IDAT":
+			seenData = true
+			// The default image is only part of the animation if a frame
+			// control chunk comes before it.
+			if cur != nil {
+				cur.data = append(cur.data, data...)
+			}
+		case "fdAT":
+			if cur == nil || len(data) < 4 {
+				return nil, errors.New("semigraph: APNG frame data without a frame control chunk")
+			}
+			cur.data = append(cur.data, data[4:]...)
+		case "IEND":
+			if !animated {
+				return nil, ErrNotAnimated
+			}
+			if len(s.frames) == 0 {
+				return nil, errors.New("semigraph: APNG has no frames")
+			}
+			return s, nil
+		default:
+			if !seenData {
+				s.ancillary = appendChunk(s.ancillary, typ, data)
+			}
+		}
+	}
+}
+
+// parseFrameControl parses the data of an fcTL chunk.
+func (s *apngSource) parseFrameControl(data []byte) (apngFrame, error) {
+	if len(data) != 26 {
+		return apngFrame{}, errors.New("semigraph: invalid APNG frame control chunk")
+	}
+	be := binary.BigEndian
+	f := apngFrame{
+		width:   int(be.Uint32(data[4:8])),
+		height:  int(be.Uint32(data[8:12])),
+		x:       int(be.Uint32(data[12:16])),
+		y:       int(be.Uint32(data[16:20])),
+		dispose: data[24],
+		op:      data[25],
+	}
+	num, den := be.Uint16(data[20:22]), be.Uint16(data[22:24])
+	if den == 0 {
+		// A denominator of 0 means hundredths of a second.
+		den = 100
+	}
+	f.delay = time.Second * time.Duration(num) / time.Duration(den)
+	if f.width == 0 || f.height == 0 || f.x+f.width > s.width || f.y+f.height > s.height {
+		return apngFrame{}, errors.New("semigraph: APNG frame is outside the canvas")
+	}
+	return f, nil
+}
+
+func (s *apngSource) Size() (width, height int) {
+	return s.width, s.height
+}
+
+func (s *apngSource) LoopCount() int {
+	// APNG counts the number of times the animation is played, with 0
+	// meaning forever.
+	if s.plays == 0 {
+		return 0
+	}
+	return s.plays - 1
+}
+
+func (s *apngSource) NextFrame() (Frame, error) {
+	if s.next >= len(s.frames) {
+		return Frame{}, io.EOF
+	}
+	af := s.frames[s.next]
+	s.next++
+
+	// Each frame is decoded as a PNG of its own, with the header of the
+	// animation resized to the frame.
+	header := bytes.Clone(s.header)
+	binary.BigEndian.PutUint32(header[0:4], uint32(af.width))
+	binary.BigEndian.PutUint32(header[4:8], uint32(af.height))
+	buf := []byte(pngSignature)
+	buf = appendChunk(buf, "IHDR", header)
+	buf = append(buf, s.ancillary...)
+	buf = appendChunk(buf, "IDAT", af.data)
+	buf = appendChunk(buf, "IEND", nil)
+	img, err := png.Decode(bytes.NewReader(buf))
+	if err != nil {
+		return Frame{}, fmt.Errorf("semigraph: decoding APNG frame %d: %w", s.next-1, err)
+	}
+
+	f := Frame{
+		Image: translate(img, image.Pt(af.x, af.y)),
+		Delay: af.delay,
+		Op:    draw.Over,
+	}
+	if af.op == 0 {
+		f.Op = draw.Src
+	}
+	switch af.dispose {
+	case 1:
+		f.Disposal = DisposalBackground
+	case 2:
+		// There is nothing to restore before the first frame, so it is
+		// cleared instead.
+		f.Disposal = DisposalPrevious
+		if s.next == 1 {
+			f.Disposal = DisposalBackground
+		}
+	}
+	return f, nil
+}
+
+// readChunk reads the next PNG chunk from r.
+func readChunk(r io.Reader) (typ string, data []byte, err error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return "", nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[:4])
+	if n > 1<<31-1 {
+		return "", nil, errors.New("chunk too large")
+	}
+	data = make([]byte, n+4)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", nil, err
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:])
+	crc.Write(data[:n])
+	if crc.Sum32() != binary.BigEndian.Uint32(data[n:]) {
+		return "", nil, fmt.Errorf("invalid checksum for %q chunk", hdr[4:])
+	}
+	return string(hdr[4:]), data[:n], nil
+}
+
+// appendChunk appends a PNG chunk to buf.
+func appendChunk(buf []byte, typ string, data []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+	start := len(buf)
+	buf = append(buf, typ...)
+	buf = append(buf, data...)
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf[start:]))
+}
+
+// translate returns img moved so its bounds start at off.
+func translate(img image.Image, off image.Point) image.Image {
+	if off == (image.Point{}) {
+		return img
+	}
+	// The pixels of the standard image types are found relative to the
+	// minimum of their bounds, so moving the bounds moves the image.
+	switch m := img.(type) {
+	case *image.RGBA:
+		m.Rect = m.Rect.Add(off)
+	case *image.NRGBA:
+		m.Rect = m.Rect.Add(off)
+	case *image.RGBA64:
+		m.Rect = m.Rect.Add(off)
+	case *image.NRGBA64:
+		m.Rect = m.Rect.Add(off)
+	case *image.Gray:
+		m.Rect = m.Rect.Add(off)
+	case *image.Gray16:
+		m.Rect = m.Rect.Add(off)
+	case *image.Paletted:
+		m.Rect = m.Rect.Add(off)
+	default:
+		dst := image.NewNRGBA(img.Bounds().Add(off))
+		draw.Draw(dst, dst.Rect, img, img.Bounds().Min, draw.Src)
+		return dst
+	}
+	return img
+}
@@ -0,0 +1,151 @@
+package semigraph
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"slices"
+	"testing"
+	"time"
+)
+
+// apngFrameSpec is a frame of a test APNG filled with a single color.
+type apngFrameSpec struct {
+	rect        image.Rectangle
+	c           color.NRGBA
+	dispose, op byte
+}
+
+// encodeAPNG returns an 8-bit RGBA APNG of the frames on a 4x4 canvas,
+// where the first frame is also the default image.
+func encodeAPNG(t *testing.T, plays uint32, frames []apngFrameSpec) []byte {
+	t.Helper()
+	be := binary.BigEndian
+	header := be.AppendUint32(nil, 4)
+	header = be.AppendUint32(header, 4)
+	header = append(header, 8, 6, 0, 0, 0)
+	actl := be.AppendUint32(nil, uint32(len(frames)))
+	actl = be.AppendUint32(actl, plays)
+
+	buf := []byte(pngSignature)
+	buf = appendChunk(buf, "IHDR", header)
+	buf = appendChunk(buf, "acTL", actl)
+	seq := uint32(0)
+	for i, f := range frames {
+		fctl := be.AppendUint32(nil, seq)
+		fctl = be.AppendUint32(fctl, uint32(f.rect.Dx()))
+		fctl = be.AppendUint32(fctl, uint32(f.rect.Dy()))
+		fctl = be.AppendUint32(fctl, uint32(f.rect.Min.X))
+		fctl = be.AppendUint32(fctl, uint32(f.rect.Min.Y))
+		fctl = be.AppendUint16(fctl, 1)
+		fctl = be.AppendUint16(fctl, 10)
+		fctl = append(fctl, f.dispose, f.op)
+		buf = appendChunk(buf, "fcTL", fctl)
+		seq++
+
+		var data bytes.Buffer
+		zw := zlib.NewWriter(&data)
+		for range f.rect.Dy() {
+			zw.Write([]byte{0}) // No filter.
+			for range f.rect.Dx() {
+				zw.Write([]byte{f.c.R, f.c.G, f.c.B, f.c.A})
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			buf = appendChunk(buf, "IDAT", data.Bytes())
+		} else {
+			buf = appendChunk(buf, "fdAT", append(be.AppendUint32(nil, seq), data.Bytes()...))
+			seq++
+		}
+	}
+	return appendChunk(buf, "IEND", nil)
+}
+
+func TestDecodeAPNG(t *testing.T) {
+	red := color.NRGBA{0xff, 0x00, 0x00, 0xff}
+	green := color.NRGBA{0x00, 0xff, 0x00, 0xff}
+	blue := color.NRGBA{0x00, 0x00, 0xff, 0xff}
+	data := encodeAPNG(t, 3, []apngFrameSpec{
+		{rect: image.Rect(0, 0, 4, 4), c: red},
+		// Restored to the red frame afterwards.
+		{rect: image.Rect(2, 2, 4, 4), c: blue, dispose: 2, op: 1},
+		// Cleared to transparent afterwards.
+		{rect: image.Rect(0, 0, 2, 2), c: green, dispose: 1, op: 1},
+		// Replaces the canvas with transparent pixels.
+		{rect: image.Rect(2, 0, 4, 2), c: color.NRGBA{}},
+	})
+
+	src, err := DecodeAPNG(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeAPNG() returned unexpected error: %v", err)
+	}
+	if w, h := src.Size(); w != 4 || h != 4 {
+		t.Errorf("Size() = %d, %d, want 4, 4", w, h)
+	}
+	if got := src.LoopCount(); got != 2 {
+		t.Errorf("LoopCount() = %d, want 2", got)
+	}
+	got := compositeSource(t, src)
+	want := []string{
+		"RRRR RRRR RRRR RRRR",
+		"RRRR RRRR RRBB RRBB",
+		"GGRR GGRR RRRR RRRR",
+		".... .... RRRR RRRR",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("compositeFrames() returned unexpected canvases:\ngot:  %q\nwant: %q", got, want)
+	}
+
+	g, err := RenderFrames(must(DecodeAPNG(bytes.NewReader(data))), nil)
+	if err != nil {
+		t.Fatalf("RenderFrames() returned unexpected error: %v", err)
+	}
+	for i, f := range g.frames {
+		if f.delay != 100*time.Millisecond {
+			t.Errorf("frame %d has delay %v, want 100ms", i, f.delay)
+		}
+	}
+}
+
+func TestDecodeAPNGNotAnimated(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeAPNG(&buf); !errors.Is(err, ErrNotAnimated) {
+		t.Errorf("DecodeAPNG() returned error %v, want ErrNotAnimated", err)
+	}
+}
+
+func TestDecodeAPNGInvalid(t *testing.T) {
+	data := encodeAPNG(t, 0, []apngFrameSpec{
+		{rect: image.Rect(0, 0, 4, 4)},
+	})
+	testCases := map[string][]byte{
+		"not_png":   []byte("GIF89a"),
+		"truncated": data[:len(data)-20],
+		"bad_crc":   append(slices.Clone(data[:len(data)-1]), data[len(data)-1]^1),
+		"frame_outside_canvas": encodeAPNG(t, 0, []apngFrameSpec{
+			{rect: image.Rect(2, 2, 6, 6)},
+		}),
+	}
+	for name, data := range testCases {
+		if _, err := DecodeAPNG(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: DecodeAPNG() returned nil error", name)
+		}
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
@@ -1,25 +1,28 @@
 package semigraph
 
 import (
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
+	"io"
 	"math"
+	"strconv"
 	"strings"
 )
 
-var toLinearLUT [256]float64
-
-func init() {
+var toLinearLUT = func() [256]float64 {
+	var lut [256]float64
 	for i := range 256 {
 		v := float64(i) / 255
 		if v < 0.04045 {
-			toLinearLUT[i] = v / 12.92
+			lut[i] = v / 12.92
 		} else {
-			toLinearLUT[i] = math.Pow((v+0.055)/1.055, 2.4)
+			lut[i] = math.Pow((v+0.055)/1.055, 2.4)
 		}
 	}
-}
+	return lut
+}()
 
 var Transparent = Color{alpha: true}
 
@@ -40,6 +43,42 @@ func RGB(r, g, b uint8) Color {
 	return Color{R: r, G: g, B: b}
 }
 
+// ParseHexColor parses a color in the form #rgb or #rrggbb, with or
+// without the leading #.
+func ParseHexColor(s string) (Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return Color{}, fmt.Errorf("semigraph: invalid color %q", s)
+	}
+	return RGB(uint8(v>>16), uint8(v>>8), uint8(v)), nil
+}
+
+// IsTransparent reports whether c is [Transparent].
+func (c Color) IsTransparent() bool {
+	return c.alpha
+}
+
+// RGBA implements [color.Color], so that c can be passed to libraries
+// that take one. [Transparent] is fully transparent black.
+func (c Color) RGBA() (r, g, b, a uint32) {
+	if c.alpha {
+		return 0, 0, 0, 0
+	}
+	return uint32(c.R) * 0x101, uint32(c.G) * 0x101, uint32(c.B) * 0x101, 0xffff
+}
+
+// equal reports whether c and o are displayed the same.
+func (c Color) equal(o Color) bool {
+	if c.alpha || o.alpha {
+		return c.alpha == o.alpha
+	}
+	return c.R == o.R && c.G == o.G && c.B == o.B
+}
+
 // to8bit returns the color's corresponding code from the 6x6x6 color cube
 // defined by the range [16,231] and whether that conversion was successful or
 // not.
@@ -69,7 +108,14 @@ func to8bit(c Color) (uint8, bool) {
 	return 16 + (r * 36) + (g * 6) + b, true
 }
 
-func writeANSI(buf *strings.Builder, c Color) {
+// ansiWriter is the subset of [strings.Builder] and [bytes.Buffer] used
+// to write escape sequences.
+type ansiWriter interface {
+	io.ByteWriter
+	io.StringWriter
+}
+
+func writeANSI(buf ansiWriter, c Color) {
 	if c.alpha {
 		return
 	}
@@ -97,23 +143,10 @@ func writeANSI(buf *strings.Builder, c Color) {
 // Where <bg> and <fg> are either 8-bit or 24-bit color codes. The escape
 // sequence for a color will be omitted if that color is [Transparent], and
 // calling WriteStyled with both fg and bg == Transparent is a no-op.
+//
+// Use [ColorProfile.WriteStyled] to limit the colors that are written.
 func WriteStyled(buf *strings.Builder, fg, bg Color) {
-	if fg.alpha && bg.alpha {
-		return
-	}
-	buf.WriteString("\x1b[")
-	if !bg.alpha {
-		buf.WriteString("48;")
-		writeANSI(buf, bg)
-	}
-	if !fg.alpha {
-		if !bg.alpha {
-			buf.WriteByte(';')
-		}
-		buf.WriteString("38;")
-		writeANSI(buf, fg)
-	}
-	buf.WriteByte('m')
+	TrueColor.writeStyled(buf, fg, bg)
 }
 
 var colorLUT = [256]string{
@@ -152,51 +185,75 @@ type ColorAtFunc func(x, y int) Color
 //
 // This is faster than using the `At` func in go's image.Image package.
 // See https://github.com/golang/go/issues/15759.
-func NewColorAtFunc(img image.Image) ColorAtFunc {
+//
+// Every image type in the standard library has a fast path, and any other
+// image falls back to converting the result of its At method. Pixels that
+// are at least half opaque are returned in their own color and the rest
+// are [Transparent].
+func NewColorAtFunc(img image.Image) (ColorAtFunc, error) {
+	return newColorAtFunc(img, compositor{})
+}
+
+// newColorAtFunc is NewColorAtFunc with partially transparent pixels
+// resolved by comp.
+func newColorAtFunc(img image.Image, comp compositor) (ColorAtFunc, error) {
 	switch p := img.(type) {
+	case nil:
+		return nil, errors.New("semigraph: nil image")
 	case *image.RGBA:
-		return newColorAtFuncRGBA(p)
+		return newColorAtFuncRGBA(p, comp), nil
 	case *image.NRGBA:
-		return newColorAtFuncNRGBA(p)
+		return newColorAtFuncNRGBA(p, comp), nil
+	case *image.RGBA64:
+		return newColorAtFuncRGBA64(p, comp), nil
+	case *image.NRGBA64:
+		return newColorAtFuncNRGBA64(p, comp), nil
 	case *image.YCbCr:
-		return newColorAtFuncYCbCr(p)
+		return newColorAtFuncYCbCr(p), nil
+	case *image.NYCbCrA:
+		return newColorAtFuncNYCbCrA(p, comp), nil
+	case *image.Gray:
+		return newColorAtFuncGray(p), nil
+	case *image.Gray16:
+		return newColorAtFuncGray16(p), nil
+	case *image.Alpha:
+		return newColorAtFuncAlpha(p, comp), nil
+	case *image.Alpha16:
+		return newColorAtFuncAlpha16(p, comp), nil
+	case *image.CMYK:
+		return newColorAtFuncCMYK(p), nil
+	case *image.Paletted:
+		return newColorAtFuncPaletted(p, comp), nil
 	default:
-		panic(fmt.Sprintf("unsupported image color mode %T", img))
+		return newColorAtFuncModel(img, comp), nil
 	}
 }
 
-func newColorAtFuncRGBA(p *image.RGBA) ColorAtFunc {
+func newColorAtFuncRGBA(p *image.RGBA, comp compositor) ColorAtFunc {
 	return func(x, y int) Color {
 		c := p.RGBAAt(x, y)
-		if c.A == 0x00 {
-			return Transparent
-		}
-		if c.A == 0xff {
-			return RGB(c.R, c.G, c.B)
-		}
-		return RGB(
-			uint8(uint32(c.R*c.A)>>8),
-			uint8(uint32(c.G*c.A)>>8),
-			uint8(uint32(c.B*c.A)>>8),
-		)
+		return comp.premultiplied(x, y, c.R, c.G, c.B, c.A)
 	}
 }
 
-func newColorAtFuncNRGBA(p *image.NRGBA) ColorAtFunc {
+func newColorAtFuncNRGBA(p *image.NRGBA, comp compositor) ColorAtFunc {
 	return func(x, y int) Color {
 		c := p.NRGBAAt(x, y)
-		if c.A == 0x00 {
-			return Transparent
-		}
-		if c.A == 0xff {
-			return RGB(c.R, c.G, c.B)
-		}
-		rr, gg, bb, aa := color.NRGBA{c.R, c.G, c.B, c.A}.RGBA()
-		return RGB(
-			uint8(rr*aa>>8),
-			uint8(gg*aa>>8),
-			uint8(bb*aa>>8),
-		)
+		return comp.straight(x, y, c.R, c.G, c.B, c.A)
+	}
+}
+
+func newColorAtFuncRGBA64(p *image.RGBA64, comp compositor) ColorAtFunc {
+	return func(x, y int) Color {
+		c := p.RGBA64At(x, y)
+		return comp.premultiplied(x, y, uint8(c.R>>8), uint8(c.G>>8), uint8(c.B>>8), uint8(c.A>>8))
+	}
+}
+
+func newColorAtFuncNRGBA64(p *image.NRGBA64, comp compositor) ColorAtFunc {
+	return func(x, y int) Color {
+		c := p.NRGBA64At(x, y)
+		return comp.straight(x, y, uint8(c.R>>8), uint8(c.G>>8), uint8(c.B>>8), uint8(c.A>>8))
 	}
 }
 
@@ -208,6 +265,75 @@ func newColorAtFuncYCbCr(p *image.YCbCr) ColorAtFunc {
 	}
 }
 
+func newColorAtFuncNYCbCrA(p *image.NYCbCrA, comp compositor) ColorAtFunc {
+	return func(x, y int) Color {
+		c := p.NYCbCrAAt(x, y)
+		r, g, b := color.YCbCrToRGB(c.Y, c.Cb, c.Cr)
+		return comp.straight(x, y, r, g, b, c.A)
+	}
+}
+
+func newColorAtFuncGray(p *image.Gray) ColorAtFunc {
+	return func(x, y int) Color {
+		c := p.GrayAt(x, y)
+		return RGB(c.Y, c.Y, c.Y)
+	}
+}
+
+func newColorAtFuncGray16(p *image.Gray16) ColorAtFunc {
+	return func(x, y int) Color {
+		v := uint8(p.Gray16At(x, y).Y >> 8)
+		return RGB(v, v, v)
+	}
+}
+
+// The alpha images are treated as a white mask.
+
+func newColorAtFuncAlpha(p *image.Alpha, comp compositor) ColorAtFunc {
+	return func(x, y int) Color {
+		a := p.AlphaAt(x, y).A
+		return comp.premultiplied(x, y, a, a, a, a)
+	}
+}
+
+func newColorAtFuncAlpha16(p *image.Alpha16, comp compositor) ColorAtFunc {
+	return func(x, y int) Color {
+		a := uint8(p.Alpha16At(x, y).A >> 8)
+		return comp.premultiplied(x, y, a, a, a, a)
+	}
+}
+
+func newColorAtFuncCMYK(p *image.CMYK) ColorAtFunc {
+	return func(x, y int) Color {
+		c := p.CMYKAt(x, y)
+		r, g, b := color.CMYKToRGB(c.C, c.M, c.Y, c.K)
+		return RGB(r, g, b)
+	}
+}
+
+func newColorAtFuncPaletted(p *image.Paletted, comp compositor) ColorAtFunc {
+	// Convert the palette once up front. Indexes outside the palette are
+	// drawn as transparent.
+	var pal [256]color.NRGBA
+	for i, c := range p.Palette[:min(len(p.Palette), 256)] {
+		pal[i] = color.NRGBAModel.Convert(c).(color.NRGBA)
+	}
+	return func(x, y int) Color {
+		if !(image.Point{x, y}.In(p.Rect)) {
+			return comp.straight(x, y, 0, 0, 0, 0)
+		}
+		c := pal[p.Pix[p.PixOffset(x, y)]]
+		return comp.straight(x, y, c.R, c.G, c.B, c.A)
+	}
+}
+
+func newColorAtFuncModel(img image.Image, comp compositor) ColorAtFunc {
+	return func(x, y int) Color {
+		r, g, b, a := img.At(x, y).RGBA()
+		return comp.premultiplied(x, y, uint8(r>>8), uint8(g>>8), uint8(b>>8), uint8(a>>8))
+	}
+}
+
 // Average returns a color representing the average of colors.
 func Average(colors []Color) Color {
 	switch len(colors) {
@@ -238,11 +364,44 @@ func toLinear(c uint8) float64 {
 
 // fromLinear converts a linear RGB channel to sRGB.
 func fromLinear(c float64) uint8 {
-	if c <= 0.0031308 {
-		c = 12.92 * c
-	} else {
-		c = 1.055*math.Pow(c, 1.0/2.4) - 0.055
+	// The transfer function doesn't quite make it back to 1 in floating
+	// point, which would turn white into 254.
+	if c >= 1 {
+		return 255
 	}
-	v := uint8(c * 255)
+	v := uint8(linearToSRGB(c) * 255)
 	return max(0, min(v, 255))
 }
+
+// linearToSRGB applies the sRGB transfer function to a linear channel in
+// [0, 1].
+func linearToSRGB(c float64) float64 {
+	if c <= 0.0031308 {
+		return 12.92 * c
+	}
+	return 1.055*math.Pow(c, 1.0/2.4) - 0.055
+}
+
+// lab is a color in the Oklab perceptual color space.
+// See https://bottosson.github.io/posts/oklab/.
+type lab struct {
+	L, A, B float64
+}
+
+func toOKLab(c Color) lab {
+	r, g, b := toLinear(c.R), toLinear(c.G), toLinear(c.B)
+	l := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	m := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	s := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+	return lab{
+		L: 0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		A: 1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		B: 0.0259040371*l + 0.7827717662*m - 0.8086757660*s,
+	}
+}
+
+// dist returns the squared distance between two colors.
+func (c lab) dist(o lab) float64 {
+	dl, da, db := c.L-o.L, c.A-o.A, c.B-o.B
+	return dl*dl + da*da + db*db
+}
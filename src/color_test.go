@@ -1,6 +1,11 @@
 package semigraph
 
 import (
+	"fmt"
+	"image"
+	"image/color"
+	stdpalette "image/color/palette"
+	"image/draw"
 	"testing"
 )
 
@@ -79,3 +84,99 @@ func TestTo8Bit(t *testing.T) {
 		}
 	}
 }
+
+func TestNewColorAtFunc(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	src.SetNRGBA(0, 0, color.NRGBA{0xff, 0x00, 0x00, 0xff})
+	src.SetNRGBA(1, 0, color.NRGBA{0x80, 0x80, 0x80, 0xff})
+	src.SetNRGBA(2, 0, color.NRGBA{0xff, 0xff, 0xff, 0x80})
+	src.SetNRGBA(3, 0, color.NRGBA{0x12, 0x34, 0x56, 0x00})
+	src.SetNRGBA(0, 1, color.NRGBA{0x12, 0x34, 0x56, 0xff})
+	src.SetNRGBA(1, 1, color.NRGBA{0xab, 0xcd, 0xef, 0x40})
+	src.SetNRGBA(2, 1, color.NRGBA{0x00, 0x00, 0x00, 0xff})
+	src.SetNRGBA(3, 1, color.NRGBA{0xff, 0xa5, 0x00, 0xff})
+
+	convert := func(dst draw.Image) image.Image {
+		draw.Draw(dst, dst.Bounds(), src, image.Point{}, draw.Src)
+		return dst
+	}
+	ycbcr := image.NewYCbCr(src.Bounds(), image.YCbCrSubsampleRatio444)
+	nycbcra := image.NewNYCbCrA(src.Bounds(), image.YCbCrSubsampleRatio420)
+	for y := range 2 {
+		for x := range 4 {
+			c := src.NRGBAAt(x, y)
+			yy, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+			ycbcr.Y[ycbcr.YOffset(x, y)] = yy
+			ycbcr.Cb[ycbcr.COffset(x, y)] = cb
+			ycbcr.Cr[ycbcr.COffset(x, y)] = cr
+			nycbcra.Y[nycbcra.YOffset(x, y)] = yy
+			nycbcra.Cb[nycbcra.COffset(x, y)] = cb
+			nycbcra.Cr[nycbcra.COffset(x, y)] = cr
+			nycbcra.A[nycbcra.AOffset(x, y)] = c.A
+		}
+	}
+	pal := color.Palette{color.Transparent, color.White, color.NRGBA{0xff, 0x00, 0x00, 0x80}}
+
+	testCases := []image.Image{
+		convert(image.NewRGBA(src.Bounds())),
+		src,
+		convert(image.NewRGBA64(src.Bounds())),
+		convert(image.NewNRGBA64(src.Bounds())),
+		ycbcr,
+		nycbcra,
+		convert(image.NewGray(src.Bounds())),
+		convert(image.NewGray16(src.Bounds())),
+		convert(image.NewAlpha(src.Bounds())),
+		convert(image.NewAlpha16(src.Bounds())),
+		convert(image.NewCMYK(src.Bounds())),
+		convert(image.NewPaletted(src.Bounds(), pal)),
+		convert(image.NewPaletted(src.Bounds(), stdpalette.WebSafe)),
+	}
+	for _, img := range testCases {
+		t.Run(fmt.Sprintf("%T", img), func(t *testing.T) {
+			at, err := NewColorAtFunc(img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The fast paths should agree with the generic path, give or take
+			// rounding when the generic path premultiplies alpha.
+			want := newColorAtFuncModel(img, compositor{})
+			for y := range 2 {
+				for x := range 4 {
+					if got, want := at(x, y), want(x, y); !nearlyEqual(got, want) {
+						t.Errorf("at(%d, %d) = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewColorAtFuncNil(t *testing.T) {
+	if _, err := NewColorAtFunc(nil); err == nil {
+		t.Error("NewColorAtFunc(nil) returned nil error")
+	}
+	if _, err := Render(nil, nil); err == nil {
+		t.Error("Render(nil) returned nil error")
+	}
+}
+
+// nearlyEqual reports whether each channel of a and b differs by at most 1.
+func nearlyEqual(a, b Color) bool {
+	if a.alpha || b.alpha {
+		return a.alpha == b.alpha
+	}
+	diff := func(x, y uint8) bool {
+		return x-y <= 1 || y-x <= 1
+	}
+	return diff(a.R, b.R) && diff(a.G, b.G) && diff(a.B, b.B)
+}
+
+func TestColorRGBA(t *testing.T) {
+	if got := color.RGBAModel.Convert(RGB(0x12, 0x34, 0x56)); got != (color.RGBA{0x12, 0x34, 0x56, 0xff}) {
+		t.Errorf("RGB(0x12, 0x34, 0x56) converts to %v", got)
+	}
+	if got := color.RGBAModel.Convert(Transparent); got != (color.RGBA{}) {
+		t.Errorf("Transparent converts to %v", got)
+	}
+}
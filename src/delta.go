@@ -0,0 +1,91 @@
+package semigraph
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// encodeDeltas encodes the update from the frame before each of frames,
+// wrapping around to the last for the first, and then drops the cells.
+func encodeDeltas(frames []*frame, prof ColorProfile) {
+	for i, f := range frames {
+		prev := frames[(i+len(frames)-1)%len(frames)]
+		f.delta, f.changed = encodeDelta(prof, prev.cells, f.cells, f.cols)
+		f.useDelta = len(f.delta) < len(f.contents)
+	}
+	for _, f := range frames {
+		f.cells = nil
+	}
+}
+
+// encodeDelta returns the escape sequences that redraw the cells of prev
+// that differ in cur, and the number of cells that do. Both are grids with
+// cols cells per row, drawn with the cursor starting at their top left
+// cell wherever it is on the screen.
+//
+// Each run of changed cells in a row is drawn after moving the cursor to
+// its start, and the cursor is moved back to the top left cell at the end.
+// The cursor is only ever moved relative to where it is, so the grid
+// doesn't have to be at the top of the screen.
+func encodeDelta(prof ColorProfile, prev, cur []styledCell, cols int) (string, int) {
+	if cols == 0 || len(prev) != len(cur) {
+		return "", 0
+	}
+	var out bytes.Buffer
+	changed := 0
+	// The cursor's row and column in the grid.
+	cy, cx := 0, 0
+	for i := 0; i < len(cur); {
+		if cur[i].equal(prev[i]) {
+			i++
+			continue
+		}
+		// Extend the run to the end of the changed cells in this row.
+		end := i + 1
+		rowEnd := (i/cols + 1) * cols
+		for end < rowEnd && !cur[end].equal(prev[end]) {
+			end++
+		}
+		writeMove(&out, cy, cx, i/cols, i%cols)
+		prof.writeCells(&out, cur[i:end])
+		cy, cx = i/cols, end-i/cols*cols
+		changed += end - i
+		i = end
+	}
+	if changed == 0 {
+		return "", 0
+	}
+	writeMove(&out, cy, cx, 0, 0)
+	return out.String(), changed
+}
+
+// writeMove writes the escape sequences that move the cursor from row cy
+// and column cx to row y and column x, relative to where it is.
+//
+// Columns to the left are reached from the start of the line, since after
+// the last column is drawn the cursor stays on it rather than moving past.
+func writeMove(out *bytes.Buffer, cy, cx, y, x int) {
+	switch {
+	case y > cy:
+		writeCSI(out, y-cy, 'B')
+	case y < cy:
+		writeCSI(out, cy-y, 'A')
+	}
+	switch {
+	case x == cx:
+	case x > cx:
+		writeCSI(out, x-cx, 'C')
+	default:
+		out.WriteByte('\r')
+		if x > 0 {
+			writeCSI(out, x, 'C')
+		}
+	}
+}
+
+// writeCSI writes a control sequence with a single parameter n.
+func writeCSI(out *bytes.Buffer, n int, final byte) {
+	out.WriteString("\x1b[")
+	out.WriteString(strconv.Itoa(n))
+	out.WriteByte(final)
+}
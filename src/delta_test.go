@@ -0,0 +1,123 @@
+package semigraph
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+	"time"
+)
+
+func TestEncodeDelta(t *testing.T) {
+	red := styledCell{r: ' ', fg: Transparent, bg: RGB(0xff, 0, 0)}
+	blue := styledCell{r: ' ', fg: Transparent, bg: RGB(0, 0, 0xff)}
+	none := styledCell{r: ' ', fg: Transparent, bg: Transparent}
+	testCases := []struct {
+		name        string
+		prev, cur   []styledCell
+		want        string
+		wantChanged int
+	}{
+		{
+			name: "unchanged",
+			prev: []styledCell{red, red, red, red},
+			cur:  []styledCell{red, red, red, red},
+			want: "",
+		},
+		{
+			name:        "one_cell",
+			prev:        []styledCell{red, red, red, red},
+			cur:         []styledCell{red, red, red, blue},
+			want:        "\x1b[1B\x1b[1C\x1b[48;5;21m \x1b[m\x1b[1A\r",
+			wantChanged: 1,
+		},
+		{
+			name:        "runs_split_at_rows",
+			prev:        []styledCell{red, red, red, red},
+			cur:         []styledCell{red, blue, blue, red},
+			want:        "\x1b[1C\x1b[48;5;21m \x1b[m\x1b[1B\r\x1b[48;5;21m \x1b[m\x1b[1A\r",
+			wantChanged: 2,
+		},
+		{
+			name:        "cleared",
+			prev:        []styledCell{red, red, red, red},
+			cur:         []styledCell{none, none, red, red},
+			want:        "  \r",
+			wantChanged: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, changed := encodeDelta(TrueColor, tc.prev, tc.cur, 2)
+			if got != tc.want || changed != tc.wantChanged {
+				t.Errorf("encodeDelta() = (%q, %d), want (%q, %d)", got, changed, tc.want, tc.wantChanged)
+			}
+		})
+	}
+}
+
+// staticGIF returns a GIF of a 16x8 cell black canvas where a single
+// white cell moves along the top row.
+func staticGIF() *gif.GIF {
+	pal := color.Palette{color.Black, color.White}
+	g := &gif.GIF{Config: image.Config{Width: 32, Height: 32}, LoopCount: -1}
+	for i := range 3 {
+		frm := image.NewPaletted(image.Rect(0, 0, 32, 32), pal)
+		for y := range 4 {
+			for x := range 2 {
+				frm.SetColorIndex(2*i+x, y, 1)
+			}
+		}
+		g.Image = append(g.Image, frm)
+		g.Delay = append(g.Delay, 1)
+		g.Disposal = append(g.Disposal, gif.DisposalNone)
+	}
+	return g
+}
+
+func TestGIFStats(t *testing.T) {
+	g, err := RenderGIF(staticGIF(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range g.Stats() {
+		if s.Changed != 2 {
+			t.Errorf("frame %d: Changed = %d, want 2", i, s.Changed)
+		}
+		if !s.UsesDelta || s.Delta >= s.Full/4 {
+			t.Errorf("frame %d: got %+v, want a delta much smaller than the full frame", i, s)
+		}
+	}
+}
+
+func TestPlayToDelta(t *testing.T) {
+	g, err := RenderGIF(staticGIF(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, full := range []bool{false, true} {
+		clock := newFakeClock()
+		var out syncBuffer
+		p := g.PlayTo(context.Background(), &out, &PlayOptions{Clock: clock, FullFrames: full})
+		for range len(g.frames) {
+			<-clock.waiting
+			clock.Advance(10 * time.Millisecond)
+		}
+		<-p.Done()
+
+		// The first frame is drawn in full and the rest as deltas.
+		want := g.frames[0].contents + "\x1b[7F"
+		for _, f := range g.frames[1:] {
+			if full {
+				want += f.contents + "\x1b[7F"
+			} else {
+				want += f.delta
+			}
+		}
+		want += "\x1b[8E"
+		if got := out.String(); got != want {
+			t.Errorf("PlayTo(FullFrames: %v) wrote unexpected byte stream:\ngot:  %q\nwant: %q", full, got, want)
+		}
+	}
+}
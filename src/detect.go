@@ -0,0 +1,287 @@
+package semigraph
+
+import (
+	"cmp"
+	"encoding/hex"
+	"errors"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Protocol is a way of drawing images in a terminal.
+type Protocol int
+
+const (
+	// ProtocolText draws images as colored text with [Render], which every
+	// terminal can display.
+	ProtocolText Protocol = iota
+
+	// ProtocolSixel draws images with [RenderSixel].
+	ProtocolSixel
+
+	// ProtocolKitty draws images with [Kitty].
+	ProtocolKitty
+
+	// ProtocolITerm draws images with [RenderITerm].
+	ProtocolITerm
+)
+
+// String returns the protocol's name: text, sixel, kitty or iterm.
+func (p Protocol) String() string {
+	switch p {
+	case ProtocolSixel:
+		return "sixel"
+	case ProtocolKitty:
+		return "kitty"
+	case ProtocolITerm:
+		return "iterm"
+	}
+	return "text"
+}
+
+// Capabilities describes what a terminal can display, as detected by
+// [DetectTerminal].
+type Capabilities struct {
+	// Name identifies the terminal, from its reply to an XTVERSION query
+	// if it gave one and otherwise from the environment, e.g.
+	// "kitty(0.35.2)" or "xterm-256color".
+	Name string
+
+	// Version is the terminal's reply to an XTVERSION query, or empty if it
+	// didn't give one.
+	Version string
+
+	// Multiplexer is "tmux" or "screen" when running inside one, in which
+	// case the terminal's replies may come from the multiplexer.
+	Multiplexer string
+
+	// Profile, Glyphs and Protocol are the best options for drawing images
+	// in the terminal.
+	Profile  ColorProfile
+	Glyphs   *GlyphSet
+	Protocol Protocol
+
+	// Attributes and Secondary are the parameters of the terminal's
+	// replies to the primary and secondary device attributes queries, or
+	// nil if it wasn't queried. Attribute 4 means it supports Sixel.
+	Attributes []int
+	Secondary  []int
+}
+
+// ID returns a string that identifies the terminal program and its
+// version, for remembering what was learned about it, as [ProbeGlyphs]
+// does. It is the terminal's reply to XTVERSION, or failing that to the
+// secondary device attributes query, which reports its model and version.
+//
+// ID is empty if the terminal replied to neither, since names from the
+// environment such as TERM are shared by many terminals that draw
+// differently.
+func (c *Capabilities) ID() string {
+	switch {
+	case c.Version != "":
+		return c.Version
+	case c.Secondary != nil:
+		params := make([]string, len(c.Secondary))
+		for i, p := range c.Secondary {
+			params[i] = strconv.Itoa(p)
+		}
+		return "DA2 " + strings.Join(params, ";")
+	}
+	return ""
+}
+
+// knownTerminals are the capabilities of terminals that can be identified
+// by name. Glyph sets are chosen for the fonts the terminals ship with or
+// draw block characters themselves, and protocols for the most capable one
+// they support.
+var knownTerminals = []struct {
+	name     string
+	profile  ColorProfile
+	glyphs   *GlyphSet
+	protocol Protocol
+}{
+	{"kitty", TrueColor, Octants, ProtocolKitty},
+	{"ghostty", TrueColor, Octants, ProtocolKitty},
+	{"wezterm", TrueColor, Octants, ProtocolITerm},
+	{"foot", TrueColor, Octants, ProtocolSixel},
+	{"iterm", TrueColor, Sextants, ProtocolITerm},
+	{"konsole", TrueColor, Sextants, ProtocolKitty},
+	{"mlterm", TrueColor, Quadrants, ProtocolSixel},
+	{"vte", TrueColor, Sextants, ProtocolText},
+	{"alacritty", TrueColor, Quadrants, ProtocolText},
+	{"vscode", TrueColor, Quadrants, ProtocolText},
+	{"apple_terminal", ANSI256, Quadrants, ProtocolText},
+	{"xterm", ANSI16, Sextants, ProtocolText},
+	{"linux", ANSI8, HalfBlocks, ProtocolText},
+	{"dumb", Monochrome, HalfBlocks, ProtocolText},
+}
+
+// identify sets the profile, glyph set and protocol of c to those of the
+// known terminal name, which is matched case insensitively by substring.
+// It reports whether the terminal is known.
+func (c *Capabilities) identify(name string) bool {
+	name = strings.ToLower(name)
+	for _, t := range knownTerminals {
+		if strings.Contains(name, t.name) {
+			c.Profile, c.Glyphs, c.Protocol = t.profile, t.glyphs, t.protocol
+			return true
+		}
+	}
+	return false
+}
+
+// terminalMarkers are environment variables that terminals set which
+// survive inside multiplexers, where TERM and TERM_PROGRAM are replaced.
+var terminalMarkers = []struct{ env, name string }{
+	{"KITTY_WINDOW_ID", "kitty"},
+	{"GHOSTTY_RESOURCES_DIR", "ghostty"},
+	{"WEZTERM_EXECUTABLE", "wezterm"},
+	{"KONSOLE_VERSION", "konsole"},
+	{"ITERM_SESSION_ID", "iterm"},
+	{"VTE_VERSION", "vte"},
+}
+
+// DetectTerminal detects the capabilities of the terminal from the
+// environment. If timeout is positive and the controlling terminal can be
+// opened, it is also queried for its version, device attributes and
+// terminfo capabilities, waiting at most timeout for it to reply.
+//
+// Terminals that can't be identified are assumed to display 16 colors
+// and quadrant characters. If the terminal should be queried but can't
+// be, because there is no controlling terminal, the platform doesn't
+// support raw mode or reads from the terminal can't be given a deadline,
+// the capabilities detected from the environment alone are returned with
+// an error saying why. A terminal that doesn't reply in time isn't an
+// error.
+func DetectTerminal(timeout time.Duration) (Capabilities, error) {
+	if timeout <= 0 {
+		return detect(os.Getenv, nil, 0)
+	}
+	f, closeTTY, err := openTTY()
+	if err != nil {
+		c, _ := detect(os.Getenv, nil, 0)
+		return c, err
+	}
+	defer closeTTY()
+	return detect(os.Getenv, f, timeout)
+}
+
+// detectQueries are sent to the terminal by detect: XTVERSION, the
+// secondary device attributes, the RGB, Tc and TN terminfo capabilities
+// with XTGETTCAP, and a kitty graphics query for a 1x1 image.
+var detectQueries = "\x1b[>0q" + "\x1b[>c" +
+	xtgettcap("RGB") + xtgettcap("Tc") + xtgettcap("TN") +
+	"\x1b_Gi=31,s=1,v=1,a=q,t=d,f=24;AAAA\x1b\\"
+
+// xtgettcap returns an XTGETTCAP query for the terminfo capability name.
+func xtgettcap(name string) string {
+	return "\x1bP+q" + hex.EncodeToString([]byte(name)) + "\x1b\\"
+}
+
+var (
+	xtversionReply = regexp.MustCompile(`\x1bP>\|([^\x1b]*)\x1b\\`)
+	da1Params      = regexp.MustCompile(`\x1b\[\?([0-9;]*)c`)
+	da2Params      = regexp.MustCompile(`\x1b\[>([0-9;]*)c`)
+	tcapReply      = regexp.MustCompile(`\x1bP1\+r([0-9A-Fa-f]+)(?:=([0-9A-Fa-f]*))?\x1b\\`)
+	kittyOK        = regexp.MustCompile(`\x1b_Gi=31;OK\x1b\\`)
+)
+
+// detect detects the capabilities of the terminal from the environment
+// variables returned by getenv and, if t isn't nil, the terminal's replies
+// to detectQueries. A terminal that doesn't reply in time is detected
+// from the environment alone, and any other error querying it is
+// returned with the capabilities.
+func detect(getenv func(string) string, t tty, timeout time.Duration) (Capabilities, error) {
+	term, prog := getenv("TERM"), getenv("TERM_PROGRAM")
+	c := Capabilities{
+		Name:     cmp.Or(prog, term),
+		Profile:  ANSI16,
+		Glyphs:   Quadrants,
+		Protocol: ProtocolText,
+	}
+	switch {
+	case getenv("TMUX") != "":
+		c.Multiplexer = "tmux"
+	case getenv("STY") != "" || strings.HasPrefix(term, "screen"):
+		c.Multiplexer = "screen"
+	}
+
+	// Markers identify the terminal even inside a multiplexer, and
+	// TERM_PROGRAM is more specific than TERM.
+	known := false
+	for _, m := range terminalMarkers {
+		if getenv(m.env) != "" {
+			known = c.identify(m.name)
+			break
+		}
+	}
+	known = known || c.identify(prog) || c.identify(term)
+
+	var (
+		reply []byte
+		err   error
+	)
+	if t != nil {
+		// Replies that arrived before a timeout are still used.
+		reply, err = query(t, detectQueries, timeout)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			err = nil
+		}
+	}
+	if m := xtversionReply.FindSubmatch(reply); m != nil {
+		c.Name = string(m[1])
+		c.Version = c.Name
+		known = c.identify(c.Name) || known
+	}
+	caps := make(map[string]string)
+	for _, m := range tcapReply.FindAllSubmatch(reply, -1) {
+		name, err1 := hex.DecodeString(string(m[1]))
+		value, err2 := hex.DecodeString(string(m[2]))
+		if err1 == nil && err2 == nil {
+			caps[string(name)] = string(value)
+		}
+	}
+	if !known && caps["TN"] != "" {
+		c.identify(caps["TN"])
+	}
+	if m := da1Params.FindSubmatch(reply); m != nil {
+		c.Attributes = parseParams(string(m[1]))
+	}
+	if m := da2Params.FindSubmatch(reply); m != nil {
+		c.Secondary = parseParams(string(m[1]))
+	}
+	switch {
+	case kittyOK.Match(reply):
+		c.Protocol = ProtocolKitty
+	case c.Protocol == ProtocolText && slices.Contains(c.Attributes, 4):
+		c.Protocol = ProtocolSixel
+	}
+
+	_, rgb := caps["RGB"]
+	_, tc := caps["Tc"]
+	switch {
+	case getenv("NO_COLOR") != "":
+		c.Profile = Monochrome
+	case rgb || tc || getenv("COLORTERM") == "truecolor" || getenv("COLORTERM") == "24bit" || strings.HasSuffix(term, "-direct"):
+		c.Profile = TrueColor
+	case strings.Contains(term, "256color"):
+		c.Profile = min(c.Profile, ANSI256)
+	}
+	return c, err
+}
+
+// parseParams parses the semicolon separated parameters of a control
+// sequence, skipping any that aren't numbers.
+func parseParams(s string) []int {
+	params := []int{}
+	for p := range strings.SplitSeq(s, ";") {
+		if v, err := strconv.Atoi(p); err == nil {
+			params = append(params, v)
+		}
+	}
+	return params
+}
@@ -0,0 +1,168 @@
+package semigraph
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDetect(t *testing.T) {
+	testCases := []struct {
+		name    string
+		env     map[string]string
+		replies map[string]string
+		want    Capabilities
+	}{
+		{
+			name: "kitty",
+			env:  map[string]string{"TERM": "xterm-kitty"},
+			want: Capabilities{Name: "xterm-kitty", Profile: TrueColor, Glyphs: Octants, Protocol: ProtocolKitty},
+		},
+		{
+			name: "xterm_256color",
+			env:  map[string]string{"TERM": "xterm-256color"},
+			want: Capabilities{Name: "xterm-256color", Profile: ANSI256, Glyphs: Sextants},
+		},
+		{
+			name: "colorterm",
+			env:  map[string]string{"TERM": "xterm-256color", "COLORTERM": "truecolor", "TERM_PROGRAM": "vscode"},
+			want: Capabilities{Name: "vscode", Profile: TrueColor, Glyphs: Quadrants},
+		},
+		{
+			name: "tmux_in_kitty",
+			env:  map[string]string{"TERM": "tmux-256color", "TERM_PROGRAM": "tmux", "TMUX": "/tmp/tmux-1000/default,1,0", "KITTY_WINDOW_ID": "1"},
+			want: Capabilities{Name: "tmux", Multiplexer: "tmux", Profile: TrueColor, Glyphs: Octants, Protocol: ProtocolKitty},
+		},
+		{
+			name: "screen",
+			env:  map[string]string{"TERM": "screen", "STY": "1234.pts-0.host"},
+			want: Capabilities{Name: "screen", Multiplexer: "screen", Profile: ANSI16, Glyphs: Quadrants},
+		},
+		{
+			name: "linux_console",
+			env:  map[string]string{"TERM": "linux"},
+			want: Capabilities{Name: "linux", Profile: ANSI8, Glyphs: HalfBlocks},
+		},
+		{
+			name: "no_color",
+			env:  map[string]string{"TERM": "xterm-kitty", "NO_COLOR": "1"},
+			want: Capabilities{Name: "xterm-kitty", Profile: Monochrome, Glyphs: Octants, Protocol: ProtocolKitty},
+		},
+		{
+			name: "queried_sixel",
+			env:  map[string]string{"TERM": "xterm-256color"},
+			replies: map[string]string{
+				"\x1b[>0q":      "\x1bP>|foot(1.16.2)\x1b\\",
+				"\x1b[>c":       "\x1b[>1;11602;0c",
+				"\x1bP+q524742": "\x1bP1+r524742\x1b\\",
+				"\x1bP+q5463":   "\x1bP0+r5463\x1b\\",
+				"\x1b[c":        "\x1b[?62;4;22c",
+			},
+			want: Capabilities{
+				Name:       "foot(1.16.2)",
+				Version:    "foot(1.16.2)",
+				Profile:    TrueColor,
+				Glyphs:     Octants,
+				Protocol:   ProtocolSixel,
+				Attributes: []int{62, 4, 22},
+				Secondary:  []int{1, 11602, 0},
+			},
+		},
+		{
+			name: "queried_kitty_graphics",
+			env:  map[string]string{"TERM": "xterm-256color"},
+			replies: map[string]string{
+				"\x1bP+q544e": "\x1bP1+r544e=787465726d2d6b69747479\x1b\\",
+				"\x1b_Gi=31":  "\x1b_Gi=31;OK\x1b\\",
+				"\x1b[c":      fakeDA1,
+			},
+			want: Capabilities{
+				Name:       "xterm-256color",
+				Profile:    ANSI256,
+				Glyphs:     Sextants,
+				Protocol:   ProtocolKitty,
+				Attributes: []int{62, 22},
+			},
+		},
+		{
+			name: "queried_terminfo_name",
+			env:  map[string]string{"TERM": "vt220"},
+			replies: map[string]string{
+				"\x1bP+q544e": "\x1bP1+r544e=6d6c7465726d\x1b\\",
+				"\x1b[c":      fakeDA1,
+			},
+			want: Capabilities{
+				Name:       "vt220",
+				Profile:    TrueColor,
+				Glyphs:     Quadrants,
+				Protocol:   ProtocolSixel,
+				Attributes: []int{62, 22},
+			},
+		},
+		{
+			name:    "no_reply",
+			env:     map[string]string{"TERM": "xterm-kitty"},
+			replies: map[string]string{},
+			want:    Capabilities{Name: "xterm-kitty", Profile: TrueColor, Glyphs: Octants, Protocol: ProtocolKitty},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var tty tty
+			if tc.replies != nil {
+				tty = &fakeTTY{replies: tc.replies}
+			}
+			got, err := detect(func(k string) string { return tc.env[k] }, tty, time.Second)
+			if err != nil {
+				t.Fatalf("detect() returned unexpected error: %v", err)
+			}
+			if got.Name != tc.want.Name || got.Version != tc.want.Version || got.Multiplexer != tc.want.Multiplexer || got.Profile != tc.want.Profile ||
+				got.Glyphs != tc.want.Glyphs || got.Protocol != tc.want.Protocol ||
+				!slices.Equal(got.Attributes, tc.want.Attributes) || !slices.Equal(got.Secondary, tc.want.Secondary) {
+				t.Errorf("detect() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+// noDeadlineTTY is a terminal whose reads can't be given a deadline.
+type noDeadlineTTY struct {
+	fakeTTY
+}
+
+func (*noDeadlineTTY) SetReadDeadline(time.Time) error {
+	return os.ErrNoDeadline
+}
+
+func TestDetectNoDeadline(t *testing.T) {
+	tty := &noDeadlineTTY{fakeTTY{replies: map[string]string{"\x1b[c": fakeDA1}}}
+	env := map[string]string{"TERM": "xterm-kitty"}
+	got, err := detect(func(k string) string { return env[k] }, tty, time.Second)
+	if !errors.Is(err, os.ErrNoDeadline) {
+		t.Errorf("detect() returned error %v, want %v", err, os.ErrNoDeadline)
+	}
+	if got.Name != "xterm-kitty" || got.Protocol != ProtocolKitty {
+		t.Errorf("detect() = %+v, want the capabilities from the environment", got)
+	}
+	if tty.written.Len() != 0 {
+		t.Errorf("detect() sent queries it couldn't wait for: %q", tty.written.String())
+	}
+}
+
+func TestCapabilitiesID(t *testing.T) {
+	testCases := []struct {
+		caps Capabilities
+		want string
+	}{
+		{Capabilities{Name: "foot(1.16.2)", Version: "foot(1.16.2)", Secondary: []int{1, 11602, 0}}, "foot(1.16.2)"},
+		{Capabilities{Name: "xterm-256color", Secondary: []int{65, 7600, 1}}, "DA2 65;7600;1"},
+		{Capabilities{Name: "xterm-256color"}, ""},
+	}
+	for _, tc := range testCases {
+		if got := tc.caps.ID(); got != tc.want {
+			t.Errorf("%+v.ID() = %q, want %q", tc.caps, got, tc.want)
+		}
+	}
+}
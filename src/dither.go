@@ -0,0 +1,350 @@
+package semigraph
+
+import (
+	"math"
+	"math/bits"
+	"math/rand/v2"
+	"sync"
+)
+
+// Dither is a method of hiding the banding caused by limiting the output
+// to a [ColorProfile].
+//
+// Dithering is done on the colors of whole cells after they have been
+// quantized, and every method is deterministic so the same image always
+// renders the same way.
+type Dither int
+
+const (
+	// DitherNone replaces each color with the closest one in the profile.
+	DitherNone Dither = iota
+
+	// DitherBayer2, DitherBayer4 and DitherBayer8 offset each cell by a
+	// threshold from a 2x2, 4x4 or 8x8 Bayer matrix before replacing its
+	// colors. Ordered dithering produces a regular crosshatch pattern that
+	// stays put between the frames of an animation.
+	DitherBayer2
+	DitherBayer4
+	DitherBayer8
+
+	// DitherFloydSteinberg diffuses the error of each cell to its four
+	// unvisited neighbors.
+	DitherFloydSteinberg
+
+	// DitherAtkinson diffuses three quarters of the error of each cell to
+	// six neighbors, which keeps more contrast than Floyd-Steinberg.
+	DitherAtkinson
+
+	// DitherSierra diffuses the error of each cell over the next two rows
+	// using the full Sierra filter.
+	DitherSierra
+
+	// DitherBlueNoise offsets each cell by a threshold from a blue noise
+	// texture, which looks less regular than a Bayer matrix.
+	DitherBlueNoise
+)
+
+// diffusion is one tap of an error diffusion filter.
+type diffusion struct {
+	dx, dy int
+	weight float64
+}
+
+var (
+	floydSteinberg = []diffusion{
+		{1, 0, 7.0 / 16},
+		{-1, 1, 3.0 / 16}, {0, 1, 5.0 / 16}, {1, 1, 1.0 / 16},
+	}
+	atkinson = []diffusion{
+		{1, 0, 1.0 / 8}, {2, 0, 1.0 / 8},
+		{-1, 1, 1.0 / 8}, {0, 1, 1.0 / 8}, {1, 1, 1.0 / 8},
+		{0, 2, 1.0 / 8},
+	}
+	sierra = []diffusion{
+		{1, 0, 5.0 / 32}, {2, 0, 3.0 / 32},
+		{-2, 1, 2.0 / 32}, {-1, 1, 4.0 / 32}, {0, 1, 5.0 / 32}, {1, 1, 4.0 / 32}, {2, 1, 2.0 / 32},
+		{-1, 2, 2.0 / 32}, {0, 2, 3.0 / 32}, {1, 2, 2.0 / 32},
+	}
+)
+
+// ditherer replaces the colors of cells with those in a profile one row
+// at a time.
+type ditherer struct {
+	profile ColorProfile
+	pixels  int // The number of pixels in a cell.
+	width   int // The number of cells in a row.
+
+	// Error diffusion state. errs holds the error carried into the current
+	// row and the two after it, each padded by two cells on either side.
+	filter []diffusion
+	errs   [3][][3]float64
+
+	// Ordered dithering state.
+	matrix []float64
+	size   int
+	spread float64
+}
+
+func newDitherer(method Dither, profile ColorProfile, gs *GlyphSet, width int) *ditherer {
+	d := &ditherer{profile: profile, pixels: gs.pixels(), width: width}
+	if profile == TrueColor {
+		return d
+	}
+	switch method {
+	case DitherFloydSteinberg:
+		d.filter = floydSteinberg
+	case DitherAtkinson:
+		d.filter = atkinson
+	case DitherSierra:
+		d.filter = sierra
+	case DitherBayer2:
+		d.matrix, d.size = bayer(1), 2
+	case DitherBayer4:
+		d.matrix, d.size = bayer(2), 4
+	case DitherBayer8:
+		d.matrix, d.size = bayer(3), 8
+	case DitherBlueNoise:
+		d.matrix, d.size = blueNoise(), blueNoiseSize
+	}
+	if d.filter != nil {
+		for i := range d.errs {
+			d.errs[i] = make([][3]float64, width+4)
+		}
+	}
+	// The ordered thresholds span roughly one step between the colors in
+	// the palette, measured in sRGB.
+	switch profile {
+	case ANSI256:
+		d.spread = 40
+	case ANSI16, ANSI8:
+		d.spread = 128
+	case Monochrome:
+		d.spread = 255
+	}
+	return d
+}
+
+// reset clears the error carried between rows so the ditherer can be
+// reused for another image of the same width.
+func (d *ditherer) reset() {
+	for i := range d.errs {
+		clear(d.errs[i])
+	}
+}
+
+// convert replaces the colors of the cells in row y with the colors of the
+// profile.
+func (d *ditherer) convert(y int, cells []cell) {
+	switch {
+	case d.filter != nil:
+		d.diffuse(cells)
+	case d.matrix != nil:
+		for x := range cells {
+			t := d.matrix[(y%d.size)*d.size+x%d.size] * d.spread
+			c := &cells[x]
+			c.fg = d.profile.Convert(offset(c.fg, t))
+			c.bg = d.profile.Convert(offset(c.bg, t))
+		}
+	default:
+		for x := range cells {
+			c := &cells[x]
+			c.fg = d.profile.Convert(c.fg)
+			c.bg = d.profile.Convert(c.bg)
+		}
+	}
+}
+
+// offset adds t to each channel of c.
+func offset(c Color, t float64) Color {
+	if c.alpha {
+		return c
+	}
+	add := func(v uint8) uint8 {
+		return uint8(min(max(float64(v)+t, 0), 255) + 0.5)
+	}
+	return RGB(add(c.R), add(c.G), add(c.B))
+}
+
+// diffuse converts a row of cells, carrying the error of each cell in
+// linear light to the cells after it.
+func (d *ditherer) diffuse(cells []cell) {
+	row := d.errs[0]
+	for x := range cells {
+		c := &cells[x]
+		e := row[x+2]
+		fgErr, fgOK := d.convertWithError(&c.fg, e)
+		bgErr, bgOK := d.convertWithError(&c.bg, e)
+
+		// The cell's error is the error of each color weighted by how many
+		// of its pixels were drawn with it.
+		fgw := float64(bits.OnesCount8(c.mask))
+		bgw := float64(d.pixels) - fgw
+		if !fgOK || c.mask == 0 {
+			fgw = 0
+		}
+		if !bgOK {
+			bgw = 0
+		}
+		if fgw+bgw == 0 {
+			continue
+		}
+		var cellErr [3]float64
+		for i := range cellErr {
+			cellErr[i] = (fgErr[i]*fgw + bgErr[i]*bgw) / (fgw + bgw)
+		}
+		for _, f := range d.filter {
+			nx := x + 2 + f.dx
+			if nx < 2 || nx >= len(cells)+2 {
+				continue
+			}
+			for i := range cellErr {
+				d.errs[f.dy][nx][i] += cellErr[i] * f.weight
+			}
+		}
+	}
+
+	// Shift the rows up and clear the last one for reuse.
+	d.errs[0], d.errs[1], d.errs[2] = d.errs[1], d.errs[2], d.errs[0]
+	clear(d.errs[2])
+}
+
+// convertWithError adds the error e to c, replaces it with the closest
+// color in the profile and returns the new error. It returns false if c
+// is transparent.
+func (d *ditherer) convertWithError(c *Color, e [3]float64) ([3]float64, bool) {
+	if c.alpha {
+		return e, false
+	}
+	want := [3]float64{toLinear(c.R) + e[0], toLinear(c.G) + e[1], toLinear(c.B) + e[2]}
+	*c = d.profile.Convert(RGB(
+		fromLinear(min(max(want[0], 0), 1)),
+		fromLinear(min(max(want[1], 0), 1)),
+		fromLinear(min(max(want[2], 0), 1)),
+	))
+	got := [3]float64{toLinear(c.R), toLinear(c.G), toLinear(c.B)}
+	return [3]float64{want[0] - got[0], want[1] - got[1], want[2] - got[2]}, true
+}
+
+// bayer returns the 2^n x 2^n Bayer matrix normalized to [-0.5, 0.5).
+func bayer(n int) []float64 {
+	size := 1 << n
+	m := make([]float64, size*size)
+	for y := range size {
+		for x := range size {
+			// Interleave the bits of x^y and y in reverse order.
+			v, xy := 0, x^y
+			for bit := range n {
+				v = v<<2 | (xy>>bit&1)<<1 | y>>bit&1
+			}
+			m[y*size+x] = (float64(v)+0.5)/float64(size*size) - 0.5
+		}
+	}
+	return m
+}
+
+const blueNoiseSize = 32
+
+// blueNoise returns a blueNoiseSize x blueNoiseSize blue noise threshold
+// matrix normalized to [-0.5, 0.5).
+var blueNoise = sync.OnceValue(func() []float64 {
+	ranks := voidAndCluster(blueNoiseSize, 1.5)
+	m := make([]float64, len(ranks))
+	for i, r := range ranks {
+		m[i] = (float64(r)+0.5)/float64(len(ranks)) - 0.5
+	}
+	return m
+})
+
+// voidAndCluster generates a size x size blue noise dither array using
+// Ulichney's void-and-cluster method, returning the rank of each cell.
+//
+// The initial pattern comes from a fixed seed so the result is always the
+// same.
+func voidAndCluster(size int, sigma float64) []int {
+	n := size * size
+	// gauss[dy*size+dx] is the energy a point contributes at a toroidal
+	// offset of (dx, dy).
+	gauss := make([]float64, n)
+	for dy := range size {
+		for dx := range size {
+			x, y := float64(min(dx, size-dx)), float64(min(dy, size-dy))
+			gauss[dy*size+dx] = math.Exp(-(x*x + y*y) / (2 * sigma * sigma))
+		}
+	}
+
+	pattern := make([]bool, n)
+	energy := make([]float64, n)
+	toggle := func(p int, set bool) {
+		pattern[p] = set
+		sign := 1.0
+		if !set {
+			sign = -1
+		}
+		px, py := p%size, p/size
+		for i := range energy {
+			dx := (i%size - px + size) % size
+			dy := (i/size - py + size) % size
+			energy[i] += sign * gauss[dy*size+dx]
+		}
+	}
+	// tightest returns the set point with the most energy, and loosest
+	// the unset point with the least.
+	tightest := func() int {
+		best := -1
+		for i, set := range pattern {
+			if set && (best < 0 || energy[i] > energy[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	loosest := func() int {
+		best := -1
+		for i, set := range pattern {
+			if !set && (best < 0 || energy[i] < energy[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	// Start with a random pattern and move points from clusters into voids
+	// until it is evenly distributed.
+	rng := rand.New(rand.NewPCG(1, 2))
+	ones := n / 10
+	for _, p := range rng.Perm(n)[:ones] {
+		toggle(p, true)
+	}
+	for {
+		c := tightest()
+		toggle(c, false)
+		v := loosest()
+		if v == c {
+			toggle(c, true)
+			break
+		}
+		toggle(v, true)
+	}
+	initial := make([]bool, n)
+	copy(initial, pattern)
+	initialEnergy := make([]float64, n)
+	copy(initialEnergy, energy)
+
+	ranks := make([]int, n)
+	// Remove the tightest clusters from the initial pattern to rank its
+	// points.
+	for r := ones - 1; r >= 0; r-- {
+		c := tightest()
+		toggle(c, false)
+		ranks[c] = r
+	}
+	// Then fill the largest voids to rank the rest.
+	copy(pattern, initial)
+	copy(energy, initialEnergy)
+	for r := ones; r < n; r++ {
+		v := loosest()
+		toggle(v, true)
+		ranks[v] = r
+	}
+	return ranks
+}
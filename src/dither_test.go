@@ -0,0 +1,95 @@
+package semigraph
+
+import (
+	"image/color"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBayer(t *testing.T) {
+	testCases := []struct {
+		n    int
+		want []int
+	}{
+		{
+			n:    1,
+			want: []int{0, 2, 3, 1},
+		},
+		{
+			n: 2,
+			want: []int{
+				0, 8, 2, 10,
+				12, 4, 14, 6,
+				3, 11, 1, 9,
+				15, 7, 13, 5,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		m := bayer(tc.n)
+		got := make([]int, len(m))
+		for i, v := range m {
+			got[i] = int((v + 0.5) * float64(len(m)))
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("bayer(%d) = %v, want %v", tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestVoidAndCluster(t *testing.T) {
+	ranks := voidAndCluster(16, 1.5)
+	seen := make([]bool, len(ranks))
+	for _, r := range ranks {
+		if r < 0 || r >= len(ranks) || seen[r] {
+			t.Fatalf("voidAndCluster returned invalid or duplicate rank %d", r)
+		}
+		seen[r] = true
+	}
+	if again := voidAndCluster(16, 1.5); !slices.Equal(ranks, again) {
+		t.Error("voidAndCluster is not deterministic")
+	}
+}
+
+func TestRenderDither(t *testing.T) {
+	gray := drawFn(4, 8, func(_, _ int) color.Color {
+		return color.Gray{128}
+	})
+	got := render(t, gray, &RenderOptions{Profile: Monochrome, Dither: DitherBayer2})
+	want := "\x1b[27m \x1b[7m \x1b[m\n\x1b[7m \x1b[27m \x1b[m"
+	if got != want {
+		t.Errorf("Render(img) returned unexpected result:\ngot:  %q\nwant: %q", got, want)
+	}
+
+	// Every method should break up a flat area that falls between two
+	// palette colors, and always in the same way.
+	flat := drawFn(32, 32, func(_, _ int) color.Color {
+		return color.Gray{100}
+	})
+	methods := []Dither{
+		DitherBayer2, DitherBayer4, DitherBayer8, DitherBlueNoise,
+		DitherFloydSteinberg, DitherAtkinson, DitherSierra,
+	}
+	for _, m := range methods {
+		opts := &RenderOptions{Profile: Monochrome, Dither: m}
+		got := render(t, flat, opts)
+		if !strings.Contains(got, "\x1b[7m") || !strings.Contains(got, "\x1b[27m") {
+			t.Errorf("Render(img) with dither %d didn't mix colors:\n%q", m, got)
+		}
+		if again := render(t, flat, opts); again != got {
+			t.Errorf("Render(img) with dither %d is not deterministic", m)
+		}
+	}
+}
+
+func TestRenderDitherTrueColor(t *testing.T) {
+	input := drawFn(14, 4, func(x, _ int) color.Color {
+		return rainbow[x/2]
+	})
+	want := render(t, input, nil)
+	got := render(t, input, &RenderOptions{Dither: DitherFloydSteinberg})
+	if got != want {
+		t.Errorf("Render(img) with true color changed when dithering:\ngot:  %q\nwant: %q", got, want)
+	}
+}
@@ -1,11 +1,15 @@
 package semigraph
 
 import (
+	"bytes"
 	"cmp"
+	"errors"
 	"image"
+	"io"
 	"math"
 	"slices"
 	"strings"
+	"sync"
 )
 
 type pixel struct {
@@ -13,57 +17,407 @@ type pixel struct {
 	color Color
 }
 
-// Render renders the img using semigraphic characters and ANSI escapes.
-func Render(img image.Image) string {
-	srcw := img.Bounds().Dx()
-	srch := img.Bounds().Dy()
-	w := int(math.Floor(float64(srcw) / 2))
-	h := int(math.Floor(float64(srch) / 4))
-	at := NewColorAtFunc(img)
-	minx, miny := img.Bounds().Min.X, img.Bounds().Min.Y
+// RenderOptions configures how an image is rendered.
+// A nil *RenderOptions is valid and uses the defaults.
+type RenderOptions struct {
+	// Glyphs is the set of characters cells are drawn with.
+	// If nil, [Octants] is used.
+	Glyphs *GlyphSet
+
+	// Columns and Rows bound the size of the output in terminal cells.
+	// The image is scaled to fit within them while keeping its aspect
+	// ratio, and if only one is set the other is derived from it. If
+	// neither is set, each pixel of the image is drawn as one pixel of a
+	// cell.
+	Columns, Rows int
+
+	// FitTerminal scales the image to fit the terminal attached to stdout,
+	// overriding Columns and Rows. It is ignored if stdout isn't a
+	// terminal.
+	FitTerminal bool
+
+	// CellAspect is the height of a terminal cell divided by its width.
+	// If zero, 2 is used, which suits most monospace fonts.
+	CellAspect float64
+
+	// CellSize is the size in pixels of a terminal cell, which the
+	// backends that draw pixels rather than characters, such as
+	// [RenderSixel], use to fit images to Columns and Rows. If zero, it is
+	// asked from the terminal attached to stdout, or derived from
+	// CellAspect if that fails.
+	CellSize image.Point
+
+	// Resample is the kernel used to scale the image.
+	Resample Resample
+
+	// Profile limits the colors in the output to those the terminal can
+	// display. Each color is replaced by the closest one in the profile.
+	Profile ColorProfile
+
+	// Background is drawn behind partially transparent pixels. If nil,
+	// pixels that are at least half opaque are drawn in their own color
+	// and the rest are left transparent so the terminal's background shows
+	// through.
+	Background Background
+
+	// Dither spreads the error from limiting colors to Profile across
+	// neighboring cells to reduce banding. It has no effect with
+	// [TrueColor].
+	Dither Dither
+
+	// Quantizer chooses how the pixels of each cell are split between the
+	// cell's two colors.
+	Quantizer Quantizer
+
+	// Workers is the number of goroutines rows of cells are rendered on.
+	// If it is zero or one, rows are rendered one after another. The
+	// output is the same either way, and error diffusion dithering always
+	// renders rows in order since each depends on the one before it.
+	//
+	// [RenderGIF] renders whole frames on the workers instead.
+	Workers int
+}
+
+func (o *RenderOptions) workers() int {
+	if o == nil {
+		return 1
+	}
+	return max(o.Workers, 1)
+}
+
+func (o *RenderOptions) profile() ColorProfile {
+	if o == nil {
+		return TrueColor
+	}
+	return o.Profile
+}
+
+func (o *RenderOptions) dither() Dither {
+	if o == nil {
+		return DitherNone
+	}
+	return o.Dither
+}
+
+func (o *RenderOptions) background() Background {
+	if o == nil {
+		return nil
+	}
+	return o.Background
+}
 
+func (o *RenderOptions) quantizer() Quantizer {
+	if o == nil {
+		return QuantizeMedian
+	}
+	return o.Quantizer
+}
+
+func (o *RenderOptions) glyphs() *GlyphSet {
+	if o == nil || o.Glyphs == nil {
+		return Octants
+	}
+	return o.Glyphs
+}
+
+// Render renders the img using semigraphic characters and ANSI escapes.
+func Render(img image.Image, opts *RenderOptions) (string, error) {
 	var out strings.Builder
-	for ty := range h {
-		ok := false
-		for tx := range w {
-			fg, bg, r := quantize(tx, ty, minx, miny, at)
-			if !fg.alpha || !bg.alpha {
-				ok = true
+	if err := NewRenderer(opts).RenderTo(&out, img); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// Renderer renders images with a fixed set of options, reusing its
+// buffers from one image to the next. A Renderer must not be used
+// concurrently.
+type Renderer struct {
+	opts *RenderOptions
+
+	rows []*rowBuffer
+	d    *ditherer
+}
+
+// rowBuffer is the scratch space used to render one row of cells.
+type rowBuffer struct {
+	cells  []cell
+	styled []styledCell
+	pixels []Color
+	line   bytes.Buffer
+}
+
+// styledCell is a cell as it is drawn in the terminal.
+type styledCell struct {
+	r      rune
+	fg, bg Color
+}
+
+// cell returns c as a [Cell] drawn with gs.
+func (c styledCell) cell(gs *GlyphSet) Cell {
+	mask, _ := gs.Mask(c.r)
+	// Drop the pixel index quantize leaves in the colors so cells can be
+	// compared with ==.
+	c.fg.idx, c.bg.idx = 0, 0
+	return Cell{Rune: c.r, FG: c.fg, BG: c.bg, Mask: mask}
+}
+
+// equal reports whether c and o are displayed the same.
+func (c styledCell) equal(o styledCell) bool {
+	return c.r == o.r && c.fg.equal(o.fg) && c.bg.equal(o.bg)
+}
+
+// NewRenderer returns a Renderer that renders images using opts.
+// A nil opts is valid and uses the defaults.
+func NewRenderer(opts *RenderOptions) *Renderer {
+	r := &Renderer{}
+	if opts != nil {
+		o := *opts
+		r.opts = &o
+	}
+	// Buffer a few rows per worker so they don't wait on each other at the
+	// end of every batch.
+	n := 1
+	if w := r.opts.workers(); w > 1 {
+		n = 4 * w
+	}
+	pixels := r.opts.glyphs().pixels()
+	r.rows = make([]*rowBuffer, n)
+	for i := range r.rows {
+		r.rows[i] = &rowBuffer{pixels: make([]Color, pixels)}
+	}
+	return r
+}
+
+// frameState is what's needed to render the rows of one image.
+type frameState struct {
+	gs         *GlyphSet
+	quant      Quantizer
+	prof       ColorProfile
+	at         ColorAtFunc
+	d          *ditherer
+	minx, miny int
+	cols, rows int
+}
+
+// RenderTo renders the img as with [Render], writing it to w one row of
+// cells at a time.
+func (r *Renderer) RenderTo(w io.Writer, img image.Image) error {
+	return r.renderTo(w, img, nil)
+}
+
+// RenderGrid renders the img as with [Render], returning its cells
+// instead of the text that draws them.
+func (r *Renderer) RenderGrid(img image.Image) (*Grid, error) {
+	gs := r.opts.glyphs()
+	g := &Grid{Glyphs: gs}
+	err := r.renderTo(io.Discard, img, func(row []styledCell) {
+		g.Cols = len(row)
+		g.Rows++
+		for _, c := range row {
+			g.Cells = append(g.Cells, c.cell(gs))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// renderTo is RenderTo, calling onRow with each row of cells in order if
+// it isn't nil. The row is only valid until onRow returns.
+func (r *Renderer) renderTo(w io.Writer, img image.Image, onRow func([]styledCell)) error {
+	if img == nil {
+		return errors.New("semigraph: nil image")
+	}
+	opts := r.opts
+	gs := opts.glyphs()
+	if sw, sh, ok := opts.scaledSize(img.Bounds(), gs); ok {
+		img = resample(img, sw, sh, opts.Resample)
+	}
+	at, err := newColorAtFunc(img, compositor{bg: opts.background()})
+	if err != nil {
+		return err
+	}
+	f := &frameState{
+		gs:    gs,
+		quant: opts.quantizer(),
+		prof:  opts.profile(),
+		at:    at,
+		minx:  img.Bounds().Min.X,
+		miny:  img.Bounds().Min.Y,
+		cols:  int(math.Floor(float64(img.Bounds().Dx()) / float64(gs.Width))),
+		rows:  int(math.Floor(float64(img.Bounds().Dy()) / float64(gs.Height))),
+	}
+
+	if r.d == nil || r.d.width != f.cols {
+		r.d = newDitherer(opts.dither(), f.prof, gs, f.cols)
+	} else {
+		r.d.reset()
+	}
+	f.d = r.d
+	for _, b := range r.rows {
+		if cap(b.cells) < f.cols {
+			b.cells = make([]cell, f.cols)
+			b.styled = make([]styledCell, f.cols)
+		}
+		b.cells = b.cells[:f.cols]
+		b.styled = b.styled[:f.cols]
+	}
+
+	// Error diffusion carries state from one row to the next, so those rows
+	// have to be rendered in order.
+	if len(r.rows) == 1 || f.d.filter != nil {
+		b := r.rows[0]
+		for ty := range f.rows {
+			f.renderRow(ty, b)
+			if _, err := w.Write(b.line.Bytes()); err != nil {
+				return err
+			}
+			if onRow != nil {
+				onRow(b.styled)
 			}
-			WriteStyled(&out, fg, bg)
-			out.WriteRune(r)
 		}
-		if ok {
-			// Only write the reset sequence if we wrote color in the first place.
+		return nil
+	}
+
+	workers := opts.workers()
+	for start := 0; start < f.rows; start += len(r.rows) {
+		batch := r.rows[:min(len(r.rows), f.rows-start)]
+		var wg sync.WaitGroup
+		for k := range min(workers, len(batch)) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := k; i < len(batch); i += workers {
+					f.renderRow(start+i, batch[i])
+				}
+			}()
+		}
+		wg.Wait()
+		for _, b := range batch {
+			if _, err := w.Write(b.line.Bytes()); err != nil {
+				return err
+			}
+			if onRow != nil {
+				onRow(b.styled)
+			}
+		}
+	}
+	return nil
+}
+
+// renderRow renders the row of cells ty into b.styled and b.line.
+func (f *frameState) renderRow(ty int, b *rowBuffer) {
+	gs, cells := f.gs, b.cells
+	for tx := range cells {
+		cells[tx] = quantize(tx, ty, f.minx, f.miny, gs, f.quant, f.at, b.pixels)
+	}
+	f.d.convert(ty, cells)
+
+	for tx, c := range cells {
+		fg, bg, ch := c.fg, c.bg, ' '
+		if c.mask != 0 && !fg.equal(bg) {
+			ch, fg, bg = gs.glyph(c.mask, fg, bg)
+		} else {
+			// Both halves of the cell are the same color.
+			fg = Transparent
+		}
+		b.styled[tx] = styledCell{r: ch, fg: fg, bg: bg}
+	}
+
+	out := &b.line
+	out.Reset()
+	f.prof.writeCells(out, b.styled)
+	if ty+1 < f.rows {
+		out.WriteByte('\n')
+	}
+}
+
+// writeCells writes a run of cells, starting and ending with the
+// terminal's default colors.
+func (p ColorProfile) writeCells(out *bytes.Buffer, cells []styledCell) {
+	styled, hasBG := false, false
+	for _, c := range cells {
+		switch {
+		case c.fg.alpha && c.bg.alpha && styled:
+			// Clear the colors of the previous cell.
 			out.WriteString("\x1b[m")
+			styled, hasBG = false, false
+		case c.bg.alpha && hasBG:
+			// Only the foreground is written, so reset the background the
+			// previous cell set.
+			out.WriteString("\x1b[49m")
+			hasBG = false
 		}
-		if ty+1 < h {
-			out.WriteByte('\n')
+		if p.writeStyled(out, c.fg, c.bg) {
+			styled = true
+			hasBG = !c.bg.alpha && p != Monochrome
 		}
+		out.WriteRune(c.r)
+	}
+	if styled {
+		// Only write the reset sequence if we wrote color in the first place.
+		out.WriteString("\x1b[m")
 	}
-	return out.String()
 }
 
-func quantize(x, y, minx, miny int, at ColorAtFunc) (fg, bg Color, contents rune) {
-	cs := make([]Color, 8)
+// cell is a quantized terminal cell. The pixels set in mask are drawn
+// with fg and the rest with bg.
+type cell struct {
+	fg, bg Color
+	mask   uint8
+}
+
+// quantize splits the pixels of the cell at (x, y) into two colors using
+// q. cs is scratch space for the cell's pixels.
+func quantize(x, y, minx, miny int, gs *GlyphSet, q Quantizer, at ColorAtFunc, cs []Color) cell {
+	n := gs.pixels()
+	cs = cs[:n]
 	var rmin, gmin, bmin uint8 = 255, 255, 255
 	var rmax, gmax, bmax uint8
-	for i := range 8 {
-		srcx := x*2 + i%2 + minx
-		srcy := y*4 + i/2 + miny
+	opaque := 0
+	for i := range n {
+		srcx := x*gs.Width + i%gs.Width + minx
+		srcy := y*gs.Height + i/gs.Width + miny
 		c := at(srcx, srcy)
 		c.idx = i
 		cs[i] = c
+		if c.alpha {
+			continue
+		}
+		opaque++
 		rmin, rmax = min(rmin, c.R), max(rmax, c.R)
 		gmin, gmax = min(gmin, c.G), max(gmax, c.G)
 		bmin, bmax = min(bmin, c.B), max(bmax, c.B)
 	}
+	switch {
+	case opaque == 0:
+		return cell{fg: Transparent, bg: Transparent}
+	case opaque < n:
+		// The transparent pixels become the background, so the glyph is the
+		// shape of the opaque ones.
+		var mask uint8
+		j := 0
+		for _, c := range cs {
+			if !c.alpha {
+				mask |= 1 << c.idx
+				cs[j] = c
+				j++
+			}
+		}
+		return cell{fg: Average(cs[:j]), bg: Transparent, mask: mask}
+	}
+
 	rRange := rmax - rmin
 	gRange := gmax - gmin
 	bRange := bmax - bmin
-	// All 8 pixels are the same color.
-	if rRange+gRange+bRange == 0 {
-		return Transparent, cs[0], ' '
+	// All the pixels are the same color.
+	if rRange|gRange|bRange == 0 {
+		return cell{fg: Transparent, bg: cs[0]}
+	}
+	if q == QuantizeOptimal {
+		return quantizeOptimal(cs)
 	}
 	switch max(rRange, gRange, bRange) {
 	case rRange:
@@ -73,13 +427,12 @@ func quantize(x, y, minx, miny int, at ColorAtFunc) (fg, bg Color, contents rune
 	case bRange:
 		slices.SortFunc(cs, sortB)
 	}
-	avgA, avgB := Average(cs[:4]), Average(cs[4:])
 
 	var mask uint8
-	for _, c := range cs[:4] {
+	for _, c := range cs[:n/2] {
 		mask |= 1 << c.idx
 	}
-	return avgA, avgB, blocks[mask]
+	return cell{fg: Average(cs[:n/2]), bg: Average(cs[n/2:]), mask: mask}
 }
 
 func sortR(a, b Color) int {
@@ -2,12 +2,16 @@ package semigraph
 
 import (
 	"bytes"
+	"fmt"
 	"image"
 	"image/color"
 	"image/png"
 	"os"
+	"regexp"
+	"runtime"
 	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func BenchmarkRender(b *testing.B) {
@@ -26,7 +30,32 @@ func BenchmarkRender(b *testing.B) {
 	b.SetBytes(int64(cfg.Width * cfg.Height * 4))
 	b.ReportAllocs()
 	for b.Loop() {
-		Render(input)
+		if _, err := Render(input, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRenderParallel(b *testing.B) {
+	data, err := os.ReadFile("testdata/benchRGB.png")
+	if err != nil {
+		b.Fatal(err)
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		b.Fatal(err)
+	}
+	input, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		b.Fatal(err)
+	}
+	opts := &RenderOptions{Workers: runtime.GOMAXPROCS(0)}
+	b.SetBytes(int64(cfg.Width * cfg.Height * 4))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := Render(input, opts); err != nil {
+			b.Fatal(err)
+		}
 	}
 }
 
@@ -93,7 +122,63 @@ func TestRender(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			got := Render(tc.input)
+			got := render(t, tc.input, nil)
+			if got != tc.want {
+				t.Errorf("Render(img) returned unexpected result:\ngot:  %q\nwant: %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRenderGlyphSets(t *testing.T) {
+	// Each input is a single cell where the pixels set in mask are black
+	// and the rest are white, so the black pixels become the foreground.
+	testCases := []struct {
+		glyphs *GlyphSet
+		mask   uint8
+		want   string
+	}{
+		{
+			glyphs: Octants,
+			mask:   0b10011001,
+			want:   "\x1b[48;5;231;38;5;16m\U0001cd89\x1b[m",
+		},
+		{
+			glyphs: Braille,
+			mask:   0b10011001,
+			want:   "\x1b[48;5;231;38;5;16m⢕\x1b[m",
+		},
+		{
+			glyphs: Sextants,
+			mask:   0b011001,
+			want:   "\x1b[48;5;231;38;5;16m\U0001fb17\x1b[m",
+		},
+		{
+			glyphs: Sextants,
+			mask:   0b010101,
+			want:   "\x1b[48;5;231;38;5;16m▌\x1b[m",
+		},
+		{
+			glyphs: Quadrants,
+			mask:   0b1001,
+			want:   "\x1b[48;5;231;38;5;16m▚\x1b[m",
+		},
+		{
+			glyphs: HalfBlocks,
+			mask:   0b10,
+			want:   "\x1b[48;5;231;38;5;16m▄\x1b[m",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s_%b", tc.glyphs.Name, tc.mask), func(t *testing.T) {
+			w := tc.glyphs.Width
+			input := drawFn(w, tc.glyphs.Height, func(x, y int) color.Color {
+				if tc.mask&(1<<(y*w+x)) != 0 {
+					return color.Black
+				}
+				return color.White
+			})
+			got := render(t, input, &RenderOptions{Glyphs: tc.glyphs})
 			if got != tc.want {
 				t.Errorf("Render(img) returned unexpected result:\ngot:  %q\nwant: %q", got, tc.want)
 			}
@@ -101,6 +186,102 @@ func TestRender(t *testing.T) {
 	}
 }
 
+func TestRenderGlyphSetsDimensions(t *testing.T) {
+	input := drawFn(12, 12, func(x, y int) color.Color {
+		return rainbow[(x+y)%len(rainbow)]
+	})
+	for _, gs := range glyphSets {
+		t.Run(gs.Name, func(t *testing.T) {
+			got := render(t, input, &RenderOptions{Glyphs: gs})
+			lines := strings.Split(got, "\n")
+			if want := 12 / gs.Height; len(lines) != want {
+				t.Errorf("Render(img) returned %d lines, want %d", len(lines), want)
+			}
+			for i, line := range lines {
+				line = ansiEscape.ReplaceAllString(line, "")
+				if got, want := utf8.RuneCountInString(line), 12/gs.Width; got != want {
+					t.Errorf("line %d has %d cells, want %d", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRendererReuse(t *testing.T) {
+	inputs := []image.Image{
+		drawFn(14, 4, func(x, _ int) color.Color {
+			return rainbow[x/2]
+		}),
+		drawFn(12, 12, func(x, y int) color.Color {
+			return rainbow[(x+y)%len(rainbow)]
+		}),
+		drawFn(4, 8, func(x, y int) color.Color {
+			return rainbow[(x*y)%len(rainbow)]
+		}),
+	}
+	opts := &RenderOptions{Profile: ANSI16, Dither: DitherFloydSteinberg}
+	r := NewRenderer(opts)
+	// Render each input twice so the second pass reuses buffers sized by
+	// the other images.
+	for i := range 2 * len(inputs) {
+		input := inputs[i%len(inputs)]
+		var got countingWriter
+		if err := r.RenderTo(&got, input); err != nil {
+			t.Fatalf("RenderTo(img) returned unexpected error: %v", err)
+		}
+		want := render(t, input, opts)
+		if got.String() != want {
+			t.Errorf("RenderTo(img) returned unexpected result:\ngot:  %q\nwant: %q", got.String(), want)
+		}
+		if rows := input.Bounds().Dy() / 4; got.writes != rows {
+			t.Errorf("RenderTo(img) made %d writes, want one per row (%d)", got.writes, rows)
+		}
+	}
+}
+
+func TestRenderParallel(t *testing.T) {
+	input := drawFn(40, 64, func(x, y int) color.Color {
+		return rainbow[(x*y+x/3)%len(rainbow)]
+	})
+	for _, opts := range []RenderOptions{
+		{},
+		{Glyphs: Braille},
+		{Profile: ANSI256, Dither: DitherBayer4},
+		{Profile: ANSI16, Dither: DitherAtkinson},
+	} {
+		want := render(t, input, &opts)
+		for _, workers := range []int{2, 3, 16} {
+			opts.Workers = workers
+			if got := render(t, input, &opts); got != want {
+				t.Errorf("Render(img, %+v) differs from the serial output:\ngot:  %q\nwant: %q", opts, got, want)
+			}
+		}
+	}
+}
+
+// countingWriter counts the calls to Write.
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// render calls Render and fails the test if it returns an error.
+func render(t testing.TB, img image.Image, opts *RenderOptions) string {
+	t.Helper()
+	out, err := Render(img, opts)
+	if err != nil {
+		t.Fatalf("Render(img) returned unexpected error: %v", err)
+	}
+	return out
+}
+
 func drawFn(x, y int, fn func(int, int) color.Color) *image.RGBA {
 	img := image.NewRGBA(image.Rect(0, 0, x, y))
 	for yy := range y {
@@ -0,0 +1,103 @@
+package semigraph
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html"
+	"image/png"
+	"io"
+)
+
+// hex returns c in the #rrggbb form used by HTML and SVG.
+func (c Color) hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// WriteHTML writes an HTML page that draws the grid as text in a <pre>
+// element, with each run of cells of the same colors in a <span> styled
+// with them. Transparent colors are left to the page.
+//
+// The characters are drawn by the browser's font, so they only look right
+// if it has them. [Grid.WriteSVG] doesn't depend on the font.
+func (g *Grid) WriteHTML(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n" +
+		"<style>pre { font-family: monospace; line-height: 1; }</style>\n" +
+		"</head>\n<body>\n<pre>")
+	for y := range g.Rows {
+		if y > 0 {
+			bw.WriteByte('\n')
+		}
+		row := g.Cells[y*g.Cols : (y+1)*g.Cols]
+		for i := 0; i < len(row); {
+			fg, bg := row[i].FG, row[i].BG
+			end := i + 1
+			for end < len(row) && row[end].FG.equal(fg) && row[end].BG.equal(bg) {
+				end++
+			}
+			var style string
+			if !fg.alpha {
+				style += "color: " + fg.hex() + ";"
+			}
+			if !bg.alpha {
+				if style != "" {
+					style += " "
+				}
+				style += "background-color: " + bg.hex() + ";"
+			}
+			if style != "" {
+				fmt.Fprintf(bw, "<span style=\"%s\">", style)
+			}
+			for _, c := range row[i:end] {
+				bw.WriteString(html.EscapeString(string(c.Rune)))
+			}
+			if style != "" {
+				bw.WriteString("</span>")
+			}
+			i = end
+		}
+	}
+	bw.WriteString("</pre>\n</body>\n</html>\n")
+	return bw.Flush()
+}
+
+// WriteSVG writes an SVG image of the grid with each cell cellWidth x
+// cellHeight in size. The pixels of each cell are drawn as rectangles, so
+// it looks the same whatever fonts are installed. Transparent pixels are
+// left out.
+func (g *Grid) WriteSVG(w io.Writer, cellWidth, cellHeight int) error {
+	if cellWidth <= 0 || cellHeight <= 0 {
+		return errors.New("semigraph: cell size must be positive")
+	}
+	img := g.Image()
+	b := img.Bounds()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" preserveAspectRatio=\"none\" shape-rendering=\"crispEdges\">\n",
+		g.Cols*cellWidth, g.Rows*cellHeight, b.Dx(), b.Dy())
+	for y := range b.Dy() {
+		// Merge runs of the same color in a row into one rectangle.
+		for x := 0; x < b.Dx(); {
+			c := img.RGBAAt(x, y)
+			end := x + 1
+			for end < b.Dx() && img.RGBAAt(end, y) == c {
+				end++
+			}
+			if c.A != 0 {
+				fmt.Fprintf(bw, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"1\" fill=\"%s\"/>\n",
+					x, y, end-x, RGB(c.R, c.G, c.B).hex())
+			}
+			x = end
+		}
+	}
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
+
+// WritePNG writes the grid to w as a PNG image of [Grid.Raster].
+func (g *Grid) WritePNG(w io.Writer, cellWidth, cellHeight int) error {
+	if cellWidth <= 0 || cellHeight <= 0 {
+		return errors.New("semigraph: cell size must be positive")
+	}
+	return png.Encode(w, g.Raster(cellWidth, cellHeight))
+}
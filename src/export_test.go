@@ -0,0 +1,103 @@
+package semigraph
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRenderGrid(t *testing.T) {
+	input := drawFn(16, 16, func(x, y int) color.Color {
+		return color.RGBA{uint8(x * 16), uint8(y * 16), 0x80, 0xff}
+	})
+	opts := &RenderOptions{Glyphs: Quadrants}
+	got, err := NewRenderer(opts).RenderGrid(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ParseANSI(strings.NewReader(render(t, input, opts)), Quadrants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Cols != 8 || got.Rows != 8 {
+		t.Errorf("RenderGrid() is %dx%d cells, want 8x8", got.Cols, got.Rows)
+	}
+	if !slices.Equal(got.Cells, want.Cells) {
+		t.Errorf("RenderGrid() cells differ from the parsed output of Render")
+	}
+}
+
+// exportGrid is a 2x1 grid of a red and blue upper half block followed by
+// an escaped character on a transparent background.
+func exportGrid() *Grid {
+	return &Grid{
+		Cols:   2,
+		Rows:   1,
+		Glyphs: HalfBlocks,
+		Cells: []Cell{
+			{Rune: '▀', FG: RGB(0xff, 0, 0), BG: RGB(0, 0, 0xff), Mask: 0b01},
+			{Rune: '<', FG: Transparent, BG: Transparent},
+		},
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := exportGrid().WriteHTML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `<pre><span style="color: #ff0000; background-color: #0000ff;">▀</span>&lt;</pre>`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("WriteHTML() = %q, want it to contain %q", buf.String(), want)
+	}
+}
+
+func TestWriteSVG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := exportGrid().WriteSVG(&buf, 8, 16); err != nil {
+		t.Fatal(err)
+	}
+	want := `<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16" viewBox="0 0 2 2" preserveAspectRatio="none" shape-rendering="crispEdges">
+<rect x="0" y="0" width="1" height="1" fill="#ff0000"/>
+<rect x="0" y="1" width="1" height="1" fill="#0000ff"/>
+</svg>
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteSVG() returned unexpected result:\ngot:  %q\nwant: %q", got, want)
+	}
+	if err := exportGrid().WriteSVG(&buf, 0, 16); err == nil {
+		t.Error("WriteSVG() with a zero cell width returned nil error")
+	}
+}
+
+func TestWritePNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := exportGrid().WritePNG(&buf, 4, 6); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 8 || b.Dy() != 6 {
+		t.Fatalf("WritePNG() image is %dx%d, want 8x6", b.Dx(), b.Dy())
+	}
+	testCases := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{0, 0, color.RGBA{0xff, 0, 0, 0xff}},
+		{3, 2, color.RGBA{0xff, 0, 0, 0xff}},
+		{3, 3, color.RGBA{0, 0, 0xff, 0xff}},
+		{0, 5, color.RGBA{0, 0, 0xff, 0xff}},
+		{4, 0, color.RGBA{}},
+	}
+	for _, tc := range testCases {
+		if got := color.RGBAModel.Convert(img.At(tc.x, tc.y)); got != tc.want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", tc.x, tc.y, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package formats
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+const farbfeldMagic = "farbfeld"
+
+// DecodeFarbfeldConfig returns the color model and dimensions of a
+// farbfeld image without decoding the entire image.
+func DecodeFarbfeldConfig(r io.Reader) (image.Config, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return image.Config{}, errors.New("farbfeld: " + err.Error())
+	}
+	if string(hdr[:8]) != farbfeldMagic {
+		return image.Config{}, errors.New("farbfeld: invalid format")
+	}
+	w := int(binary.BigEndian.Uint32(hdr[8:12]))
+	h := int(binary.BigEndian.Uint32(hdr[12:16]))
+	if err := checkSize("farbfeld", w, h); err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.NRGBA64Model, Width: w, Height: h}, nil
+}
+
+// DecodeFarbfeld reads a farbfeld image from r and returns it as an
+// [image.NRGBA64].
+//
+// See https://tools.suckless.org/farbfeld/.
+func DecodeFarbfeld(r io.Reader) (image.Image, error) {
+	cfg, err := DecodeFarbfeldConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	// Farbfeld stores 16-bit big endian RGBA pixels, which is exactly how
+	// an NRGBA64 lays them out.
+	img := image.NewNRGBA64(image.Rect(0, 0, cfg.Width, cfg.Height))
+	if _, err := io.ReadFull(r, img.Pix); err != nil {
+		return nil, errors.New("farbfeld: " + err.Error())
+	}
+	return img, nil
+}
@@ -0,0 +1,34 @@
+package formats
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDecodeFarbfeld(t *testing.T) {
+	data := []byte("farbfeld\x00\x00\x00\x02\x00\x00\x00\x01" +
+		"\xff\xff\x00\x00\x00\x00\xff\xff" +
+		"\x12\x34\x56\x78\x9a\xbc\x80\x00")
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("image.Decode() returned unexpected error: %v", err)
+	}
+	if format != "farbfeld" {
+		t.Errorf("image.Decode() returned format %q, want farbfeld", format)
+	}
+	want := []color.NRGBA64{
+		{0xffff, 0x0000, 0x0000, 0xffff},
+		{0x1234, 0x5678, 0x9abc, 0x8000},
+	}
+	for x, w := range want {
+		if got := img.(*image.NRGBA64).NRGBA64At(x, 0); got != w {
+			t.Errorf("pixel %d = %v, want %v", x, got, w)
+		}
+	}
+
+	if _, err := DecodeFarbfeld(bytes.NewReader(data[:20])); err == nil {
+		t.Error("DecodeFarbfeld() returned nil error for truncated image")
+	}
+}
@@ -0,0 +1,39 @@
+// Package formats registers decoders for image formats that neither the
+// standard library nor golang.org/x/image support: Netpbm (PBM, PGM and
+// PPM), QOI and farbfeld.
+//
+// Import it for its side effects to decode these formats with
+// [image.Decode]:
+//
+//	import _ "github.com/jessesomerville/semigraph/src/formats"
+package formats
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// maxPixels bounds the size of the images that are decoded, so a corrupt
+// header can't make a decoder allocate an unreasonable amount of memory.
+const maxPixels = 1 << 28
+
+// checkSize returns an error if an image of width x height pixels is
+// empty or too big to decode.
+func checkSize(format string, width, height int) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("%s: invalid image size %dx%d", format, width, height)
+	}
+	if width > maxPixels/height {
+		return errors.New(format + ": image is too large")
+	}
+	return nil
+}
+
+func init() {
+	for _, magic := range []string{"P1", "P2", "P3", "P4", "P5", "P6"} {
+		image.RegisterFormat("netpbm", magic, DecodeNetpbm, DecodeNetpbmConfig)
+	}
+	image.RegisterFormat("qoi", "qoif", DecodeQOI, DecodeQOIConfig)
+	image.RegisterFormat("farbfeld", "farbfeld", DecodeFarbfeld, DecodeFarbfeldConfig)
+}
@@ -0,0 +1,264 @@
+package formats
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// netpbmHeader is the header of a PBM, PGM or PPM image.
+type netpbmHeader struct {
+	magic         byte // The digit after the P.
+	width, height int
+	maxval        int
+}
+
+// readNetpbmHeader reads the header, leaving r at the first byte of the
+// pixel data.
+func readNetpbmHeader(r *bufio.Reader) (netpbmHeader, error) {
+	var magic [2]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return netpbmHeader{}, netpbmError(err)
+	}
+	if magic[0] != 'P' || magic[1] < '1' || magic[1] > '6' {
+		return netpbmHeader{}, errors.New("netpbm: invalid format")
+	}
+	h := netpbmHeader{magic: magic[1], maxval: 1}
+	fields := []*int{&h.width, &h.height}
+	if h.magic != '1' && h.magic != '4' {
+		fields = append(fields, &h.maxval)
+	}
+	for _, f := range fields {
+		v, err := readNetpbmInt(r)
+		if err != nil {
+			return netpbmHeader{}, err
+		}
+		*f = v
+	}
+	// A single whitespace character separates the header from binary data.
+	if h.magic >= '4' {
+		if _, err := r.ReadByte(); err != nil {
+			return netpbmHeader{}, netpbmError(err)
+		}
+	}
+	if err := checkSize("netpbm", h.width, h.height); err != nil {
+		return netpbmHeader{}, err
+	}
+	if h.maxval < 1 || h.maxval > 0xffff {
+		return netpbmHeader{}, fmt.Errorf("netpbm: invalid maximum value %d", h.maxval)
+	}
+	return h, nil
+}
+
+// readNetpbmInt reads a decimal number, skipping any whitespace and
+// comments before it.
+func readNetpbmInt(r *bufio.Reader) (int, error) {
+	b, err := skipNetpbmSpace(r)
+	if err != nil {
+		return 0, err
+	}
+	if b < '0' || b > '9' {
+		return 0, fmt.Errorf("netpbm: unexpected %q in header", b)
+	}
+	v := 0
+	for b >= '0' && b <= '9' {
+		v = v*10 + int(b-'0')
+		if v > maxPixels {
+			return 0, errors.New("netpbm: number too large")
+		}
+		b, err = r.ReadByte()
+		if err == io.EOF {
+			return v, nil
+		}
+		if err != nil {
+			return 0, netpbmError(err)
+		}
+	}
+	return v, r.UnreadByte()
+}
+
+// skipNetpbmSpace skips whitespace and comments and returns the byte after
+// them.
+func skipNetpbmSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, netpbmError(err)
+		}
+		switch b {
+		case ' ', '\t', '\n', '\v', '\f', '\r':
+		case '#':
+			if _, err := r.ReadString('\n'); err != nil {
+				return 0, netpbmError(err)
+			}
+		default:
+			return b, nil
+		}
+	}
+}
+
+// DecodeNetpbmConfig returns the color model and dimensions of a PBM, PGM
+// or PPM image without decoding the entire image.
+func DecodeNetpbmConfig(r io.Reader) (image.Config, error) {
+	h, err := readNetpbmHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: h.colorModel(), Width: h.width, Height: h.height}, nil
+}
+
+func (h netpbmHeader) colorModel() color.Model {
+	switch {
+	case h.magic == '3' || h.magic == '6':
+		if h.maxval > 0xff {
+			return color.RGBA64Model
+		}
+		return color.RGBAModel
+	case h.maxval > 0xff:
+		return color.Gray16Model
+	default:
+		return color.GrayModel
+	}
+}
+
+// DecodeNetpbm reads a PBM, PGM or PPM image in either the plain or raw
+// format from r. Bitmaps and graymaps are returned as an [image.Gray] and
+// pixmaps as an [image.RGBA], or their 16-bit equivalents if the maximum
+// value is more than 255. Samples are scaled to the full range of the
+// image's channels.
+//
+// See https://netpbm.sourceforge.net/doc/.
+func DecodeNetpbm(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readNetpbmHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	bounds := image.Rect(0, 0, h.width, h.height)
+	n := h.width * h.height
+
+	if h.magic == '4' {
+		// Raw bitmaps pack 8 pixels into each byte, with every row starting
+		// on a new byte, and 1 is black.
+		img := image.NewGray(bounds)
+		row := make([]byte, (h.width+7)/8)
+		for y := range h.height {
+			if _, err := io.ReadFull(br, row); err != nil {
+				return nil, netpbmError(err)
+			}
+			for x := range h.width {
+				if row[x/8]&(0x80>>(x%8)) == 0 {
+					img.Pix[y*img.Stride+x] = 0xff
+				}
+			}
+		}
+		return img, nil
+	}
+
+	channels := 1
+	if h.magic == '3' || h.magic == '6' {
+		channels = 3
+	}
+	samples := make([]int, n*channels)
+	if err := h.readSamples(br, samples); err != nil {
+		return nil, err
+	}
+	if h.magic == '1' {
+		// Plain bitmaps are 1 for black, the reverse of graymaps.
+		for i, s := range samples {
+			samples[i] = 1 - s
+		}
+	}
+
+	scale := func(s int) uint32 {
+		return uint32(min(s, h.maxval)) * 0xffff / uint32(h.maxval)
+	}
+	switch {
+	case channels == 1 && h.maxval <= 0xff:
+		img := image.NewGray(bounds)
+		for i, s := range samples {
+			img.Pix[i] = uint8(scale(s) >> 8)
+		}
+		return img, nil
+	case channels == 1:
+		img := image.NewGray16(bounds)
+		for i, s := range samples {
+			v := scale(s)
+			img.Pix[2*i], img.Pix[2*i+1] = uint8(v>>8), uint8(v)
+		}
+		return img, nil
+	case h.maxval <= 0xff:
+		img := image.NewRGBA(bounds)
+		for i := range n {
+			for c := range 3 {
+				img.Pix[4*i+c] = uint8(scale(samples[3*i+c]) >> 8)
+			}
+			img.Pix[4*i+3] = 0xff
+		}
+		return img, nil
+	default:
+		img := image.NewRGBA64(bounds)
+		for i := range n {
+			for c := range 3 {
+				v := scale(samples[3*i+c])
+				img.Pix[8*i+2*c], img.Pix[8*i+2*c+1] = uint8(v>>8), uint8(v)
+			}
+			img.Pix[8*i+6], img.Pix[8*i+7] = 0xff, 0xff
+		}
+		return img, nil
+	}
+}
+
+// readSamples fills samples from the pixel data of a plain or raw graymap
+// or pixmap, or a plain bitmap.
+func (h netpbmHeader) readSamples(r *bufio.Reader, samples []int) error {
+	switch h.magic {
+	case '1':
+		// The digits of plain bitmaps don't need to be separated.
+		for i := range samples {
+			b, err := skipNetpbmSpace(r)
+			if err != nil {
+				return err
+			}
+			if b != '0' && b != '1' {
+				return fmt.Errorf("netpbm: unexpected %q in bitmap", b)
+			}
+			samples[i] = int(b - '0')
+		}
+	case '2', '3':
+		for i := range samples {
+			v, err := readNetpbmInt(r)
+			if err != nil {
+				return err
+			}
+			samples[i] = v
+		}
+	default:
+		size := 1
+		if h.maxval > 0xff {
+			size = 2
+		}
+		buf := make([]byte, len(samples)*size)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return netpbmError(err)
+		}
+		for i := range samples {
+			if size == 2 {
+				samples[i] = int(buf[2*i])<<8 | int(buf[2*i+1])
+			} else {
+				samples[i] = int(buf[i])
+			}
+		}
+	}
+	return nil
+}
+
+func netpbmError(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return errors.New("netpbm: " + err.Error())
+}
@@ -0,0 +1,101 @@
+package formats
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDecodeNetpbm(t *testing.T) {
+	black := color.RGBA64{0, 0, 0, 0xffff}
+	white := color.RGBA64{0xffff, 0xffff, 0xffff, 0xffff}
+	gray := color.RGBA64{0x8888, 0x8888, 0x8888, 0xffff}
+	orange := color.RGBA64{0xffff, 0x8080, 0x0000, 0xffff}
+	testCases := []struct {
+		name  string
+		input string
+		want  []color.RGBA64
+	}{
+		{
+			name:  "plain_pbm",
+			input: "P1\n# comment\n3 1\n1 0\n1",
+			want:  []color.RGBA64{black, white, black},
+		},
+		{
+			name:  "plain_pbm_packed",
+			input: "P1 3 1 101",
+			want:  []color.RGBA64{black, white, black},
+		},
+		{
+			name:  "raw_pbm",
+			input: "P4 3 1\n\xa0",
+			want:  []color.RGBA64{black, white, black},
+		},
+		{
+			name:  "plain_pgm",
+			input: "P2 3 1 15\n0 8 15\n",
+			want:  []color.RGBA64{black, gray, white},
+		},
+		{
+			name:  "raw_pgm",
+			input: "P5 3 1 255\n\x00\x88\xff",
+			want:  []color.RGBA64{black, gray, white},
+		},
+		{
+			name:  "raw_pgm_16bit",
+			input: "P5 3 1 65535\n\x00\x00\x88\x88\xff\xff",
+			want:  []color.RGBA64{black, gray, white},
+		},
+		{
+			name:  "plain_ppm",
+			input: "P3\n2 1\n255\n255 128 0  0 0 0\n",
+			want:  []color.RGBA64{orange, black},
+		},
+		{
+			name:  "raw_ppm",
+			input: "P6 2 1 255\n\xff\x80\x00\x00\x00\x00",
+			want:  []color.RGBA64{orange, black},
+		},
+		{
+			name:  "raw_ppm_16bit",
+			input: "P6 2 1 65535\n\xff\xff\x80\x80\x00\x00\x00\x00\x00\x00\x00\x00",
+			want:  []color.RGBA64{orange, black},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			img, format, err := image.Decode(bytes.NewReader([]byte(tc.input)))
+			if err != nil {
+				t.Fatalf("image.Decode() returned unexpected error: %v", err)
+			}
+			if format != "netpbm" {
+				t.Errorf("image.Decode() returned format %q, want netpbm", format)
+			}
+			if got := img.Bounds(); got != image.Rect(0, 0, len(tc.want), 1) {
+				t.Errorf("image has bounds %v, want %d pixels", got, len(tc.want))
+			}
+			for x, w := range tc.want {
+				if got := color.RGBA64Model.Convert(img.At(x, 0)); got != w {
+					t.Errorf("pixel %d = %v, want %v", x, got, w)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeNetpbmInvalid(t *testing.T) {
+	testCases := map[string]string{
+		"bad_magic":     "P9 1 1 255\n\x00",
+		"zero_size":     "P5 0 1 255\n",
+		"bad_maxval":    "P5 1 1 70000\n\x00",
+		"truncated":     "P6 2 1 255\n\xff\x80",
+		"bad_bit":       "P1 2 1 0 2",
+		"missing_field": "P2 2",
+	}
+	for name, input := range testCases {
+		if _, err := DecodeNetpbm(bytes.NewReader([]byte(input))); err == nil {
+			t.Errorf("%s: DecodeNetpbm() returned nil error", name)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package formats
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+const qoiMagic = "qoif"
+
+// The QOI chunk tags.
+const (
+	qoiOpIndex = 0x00
+	qoiOpDiff  = 0x40
+	qoiOpLuma  = 0x80
+	qoiOpRun   = 0xc0
+	qoiOpRGB   = 0xfe
+	qoiOpRGBA  = 0xff
+	qoiMask    = 0xc0
+)
+
+// DecodeQOIConfig returns the color model and dimensions of a QOI image
+// without decoding the entire image.
+func DecodeQOIConfig(r io.Reader) (image.Config, error) {
+	var hdr [14]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return image.Config{}, errors.New("qoi: " + err.Error())
+	}
+	if string(hdr[:4]) != qoiMagic {
+		return image.Config{}, errors.New("qoi: invalid format")
+	}
+	w := int(binary.BigEndian.Uint32(hdr[4:8]))
+	h := int(binary.BigEndian.Uint32(hdr[8:12]))
+	if err := checkSize("qoi", w, h); err != nil {
+		return image.Config{}, err
+	}
+	if c := hdr[12]; c != 3 && c != 4 {
+		return image.Config{}, errors.New("qoi: invalid number of channels")
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: w, Height: h}, nil
+}
+
+// DecodeQOI reads a QOI image from r and returns it as an [image.NRGBA].
+//
+// See https://qoiformat.org/qoi-specification.pdf.
+func DecodeQOI(r io.Reader) (image.Image, error) {
+	cfg, err := DecodeQOIConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, cfg.Width, cfg.Height))
+	br := bufio.NewReader(r)
+	var index [64][4]byte
+	px := [4]byte{0, 0, 0, 0xff}
+	run := 0
+	for i := 0; i < len(img.Pix); i += 4 {
+		if run > 0 {
+			run--
+		} else {
+			b, err := br.ReadByte()
+			if err != nil {
+				return nil, qoiError(err)
+			}
+			switch {
+			case b == qoiOpRGB:
+				if _, err := io.ReadFull(br, px[:3]); err != nil {
+					return nil, qoiError(err)
+				}
+			case b == qoiOpRGBA:
+				if _, err := io.ReadFull(br, px[:]); err != nil {
+					return nil, qoiError(err)
+				}
+			case b&qoiMask == qoiOpIndex:
+				px = index[b]
+			case b&qoiMask == qoiOpDiff:
+				px[0] += (b>>4)&0x03 - 2
+				px[1] += (b>>2)&0x03 - 2
+				px[2] += b&0x03 - 2
+			case b&qoiMask == qoiOpLuma:
+				b2, err := br.ReadByte()
+				if err != nil {
+					return nil, qoiError(err)
+				}
+				dg := b&0x3f - 32
+				px[0] += dg + (b2>>4)&0x0f - 8
+				px[1] += dg
+				px[2] += dg + b2&0x0f - 8
+			case b&qoiMask == qoiOpRun:
+				run = int(b & 0x3f)
+			}
+			index[(int(px[0])*3+int(px[1])*5+int(px[2])*7+int(px[3])*11)%64] = px
+		}
+		copy(img.Pix[i:i+4], px[:])
+	}
+	return img, nil
+}
+
+func qoiError(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return errors.New("qoi: " + err.Error())
+}
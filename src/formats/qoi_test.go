@@ -0,0 +1,58 @@
+package formats
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDecodeQOI(t *testing.T) {
+	data := []byte("qoif\x00\x00\x00\x07\x00\x00\x00\x01\x04\x00")
+	data = append(data,
+		0xfe, 0x10, 0x20, 0x30, // RGB
+		0xc1,       // Run of 2
+		0x76,       // Diff of +1, -1, 0
+		0xa5, 0x6b, // Luma with green +5, red -2 and blue +3 from it
+		0xff, 0, 0, 0, 0x80, // RGBA
+		0x15, // Index of the first pixel
+		0, 0, 0, 0, 0, 0, 0, 1,
+	)
+	img, err := DecodeQOI(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeQOI() returned unexpected error: %v", err)
+	}
+	want := []color.NRGBA{
+		{0x10, 0x20, 0x30, 0xff},
+		{0x10, 0x20, 0x30, 0xff},
+		{0x10, 0x20, 0x30, 0xff},
+		{0x11, 0x1f, 0x30, 0xff},
+		{0x14, 0x24, 0x38, 0xff},
+		{0x00, 0x00, 0x00, 0x80},
+		{0x10, 0x20, 0x30, 0xff},
+	}
+	for x, w := range want {
+		if got := img.(*image.NRGBA).NRGBAAt(x, 0); got != w {
+			t.Errorf("pixel %d = %v, want %v", x, got, w)
+		}
+	}
+
+	// Registered with the image package.
+	if _, format, err := image.Decode(bytes.NewReader(data)); err != nil || format != "qoi" {
+		t.Errorf("image.Decode() = %q, %v, want qoi", format, err)
+	}
+}
+
+func TestDecodeQOIInvalid(t *testing.T) {
+	testCases := map[string]string{
+		"bad_magic":    "qoix\x00\x00\x00\x01\x00\x00\x00\x01\x04\x00\xfe\x00\x00\x00",
+		"empty":        "qoif\x00\x00\x00\x00\x00\x00\x00\x01\x04\x00",
+		"bad_channels": "qoif\x00\x00\x00\x01\x00\x00\x00\x01\x05\x00\xfe\x00\x00\x00",
+		"truncated":    "qoif\x00\x00\x00\x02\x00\x00\x00\x01\x04\x00\xfe\x00\x00\x00",
+	}
+	for name, data := range testCases {
+		if _, err := DecodeQOI(bytes.NewReader([]byte(data))); err == nil {
+			t.Errorf("%s: DecodeQOI() returned nil error", name)
+		}
+	}
+}
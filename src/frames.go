@@ -0,0 +1,183 @@
+package semigraph
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+)
+
+// Disposal is what happens to the area of the canvas a frame was drawn on
+// before the next frame is drawn.
+type Disposal int
+
+const (
+	// DisposalNone leaves the frame in place.
+	DisposalNone Disposal = iota
+
+	// DisposalBackground clears the frame's area to its background.
+	DisposalBackground
+
+	// DisposalPrevious restores the frame's area to what it was before the
+	// frame was drawn.
+	DisposalPrevious
+)
+
+// Frame is one frame of an animation.
+type Frame struct {
+	// Image is drawn onto the canvas within its bounds.
+	Image image.Image
+
+	// Delay is how long the frame is shown for.
+	Delay time.Duration
+
+	// Disposal is what happens to the frame before the next is drawn.
+	Disposal Disposal
+
+	// Op is how the frame is combined with the canvas: [draw.Over] blends
+	// it over what is already there and [draw.Src] replaces it.
+	Op draw.Op
+
+	// Background is the color the frame's area is cleared to by
+	// [DisposalBackground]. The first frame's background is also the color
+	// of the canvas before it is drawn. If nil, the canvas is cleared to
+	// transparent.
+	Background color.Color
+}
+
+// FrameSource is a sequence of animation frames, such as the frames of a
+// GIF or APNG or a video stream.
+type FrameSource interface {
+	// Size returns the size of the canvas in pixels.
+	Size() (width, height int)
+
+	// LoopCount returns the number of times the frames are repeated after
+	// they are first shown, with the same meaning as in [gif.GIF]: 0
+	// repeats them forever and -1 shows them once.
+	LoopCount() int
+
+	// NextFrame returns the next frame, or io.EOF after the last one.
+	NextFrame() (Frame, error)
+}
+
+// compositeFrames draws each frame read from src onto the canvas and calls
+// fn with it. The canvas is reused for the next frame once fn returns.
+//
+// Each frame is drawn at its offset over what the previous frames left
+// behind, and is then disposed of as the frame specifies: left in place,
+// cleared to the background, or restored to the canvas as it was before
+// the frame was drawn.
+func compositeFrames(src FrameSource, fn func(i int, canvas *image.RGBA, f Frame) error) error {
+	w, h := src.Size()
+	bounds := image.Rect(0, 0, w, h)
+	canvas := image.NewRGBA(bounds)
+	var prev *image.RGBA // Only allocated if a frame restores to previous.
+	for i := 0; ; i++ {
+		f, err := src.NextFrame()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			fillRect(canvas, bounds, f.Background)
+		}
+		r := f.Image.Bounds().Intersect(bounds)
+		if f.Disposal == DisposalPrevious {
+			if prev == nil {
+				prev = image.NewRGBA(bounds)
+			}
+			copy(prev.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, r, f.Image, r.Min, f.Op)
+		if err := fn(i, canvas, f); err != nil {
+			return err
+		}
+		switch f.Disposal {
+		case DisposalBackground:
+			fillRect(canvas, r, f.Background)
+		case DisposalPrevious:
+			copy(canvas.Pix, prev.Pix)
+		}
+	}
+}
+
+// fillRect sets every pixel of img in r to c, or to transparent if c is
+// nil.
+func fillRect(img *image.RGBA, r image.Rectangle, c color.Color) {
+	if c == nil {
+		c = color.Transparent
+	}
+	draw.Draw(img, r, &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+// gifSource is a FrameSource for the frames of a GIF.
+type gifSource struct {
+	g    *gif.GIF
+	next int
+}
+
+// NewGIFSource returns a [FrameSource] for the frames of g.
+func NewGIFSource(g *gif.GIF) (FrameSource, error) {
+	nFrames := len(g.Image)
+
+	if nFrames == 0 {
+		return nil, errors.New("semigraph: GIF has no frames")
+	}
+	if nFrames != len(g.Delay) || nFrames != len(g.Disposal) {
+		return nil, errors.New("semigraph: mismatched GIF frame, disposal, and delay lengths")
+	}
+	return &gifSource{g: g}, nil
+}
+
+func (s *gifSource) Size() (width, height int) {
+	return s.g.Config.Width, s.g.Config.Height
+}
+
+func (s *gifSource) LoopCount() int {
+	return s.g.LoopCount
+}
+
+func (s *gifSource) NextFrame() (Frame, error) {
+	if s.next >= len(s.g.Image) {
+		return Frame{}, io.EOF
+	}
+	i := s.next
+	s.next++
+	frm := s.g.Image[i]
+	f := Frame{
+		Image:      frm,
+		Delay:      time.Millisecond * time.Duration(s.g.Delay[i]) * 10,
+		Background: gifBackground(s.g, frm),
+	}
+	switch s.g.Disposal[i] {
+	case gif.DisposalBackground:
+		f.Disposal = DisposalBackground
+	case gif.DisposalPrevious:
+		f.Disposal = DisposalPrevious
+	}
+	return f, nil
+}
+
+// gifBackground returns the color the canvas is cleared to when frm is
+// disposed of. This is the background color from the global color table,
+// unless there is no global color table or frm has a transparent color.
+// Like browsers, transparent frames clear to transparent so the terminal
+// shows through rather than an opaque background the frame would hide.
+func gifBackground(g *gif.GIF, frm *image.Paletted) color.Color {
+	pal, ok := g.Config.ColorModel.(color.Palette)
+	i := int(g.BackgroundIndex)
+	if !ok || i >= len(pal) {
+		return nil
+	}
+	for _, c := range frm.Palette {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return nil
+		}
+	}
+	return pal[i]
+}
@@ -0,0 +1,147 @@
+package semigraph
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompositeFrames(t *testing.T) {
+	// Each frame of the canvas is written as rows of R, G, B and W for red,
+	// green, blue and white pixels, and . for transparent ones. Every test
+	// GIF draws a full red frame, then a blue frame in the bottom right
+	// quadrant and a green one in the top left.
+	testCases := []struct {
+		file string
+		want []string
+	}{
+		{
+			file: "disposal-none.gif",
+			want: []string{
+				"RRRR RRRR RRRR RRRR",
+				"RRRR RRRR RRBB RRBB",
+				"GGRR GGRR RRBB RRBB",
+			},
+		},
+		{
+			file: "disposal-background.gif",
+			want: []string{
+				"RRRR RRRR RRRR RRRR",
+				"WWWW WWWW WWBB WWBB",
+				"GGWW GGWW WWWW WWWW",
+			},
+		},
+		{
+			file: "disposal-previous.gif",
+			want: []string{
+				"RRRR RRRR RRRR RRRR",
+				"RRRR RRRR RRBB RRBB",
+				"GGRR GGRR RRRR RRRR",
+			},
+		},
+		{
+			// The second frame is blue with every other pixel transparent,
+			// and the background is the transparent color.
+			file: "disposal-transparent.gif",
+			want: []string{
+				"RRRR RRRR RRRR RRRR",
+				"RBRB RBRB RBRB RBRB",
+				"GG.. GG.. .... ....",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.file, func(t *testing.T) {
+			f, err := os.Open("testdata/" + tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			g, err := gif.DecodeAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := compositeGIF(t, g)
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("compositeFrames() returned unexpected canvases:\ngot:  %q\nwant: %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCompositeFramesOffset(t *testing.T) {
+	pal := color.Palette{color.White, color.Black}
+	// A single frame that only covers the bottom right of the canvas.
+	frm := image.NewPaletted(image.Rect(2, 2, 4, 4), pal)
+	for i := range frm.Pix {
+		frm.Pix[i] = 1
+	}
+	g := &gif.GIF{
+		Image:    []*image.Paletted{frm},
+		Delay:    []int{0},
+		Disposal: []byte{0},
+		Config:   image.Config{Width: 4, Height: 4},
+	}
+	want := []string{".... .... ..KK ..KK"}
+	if got := compositeGIF(t, g); !slices.Equal(got, want) {
+		t.Errorf("compositeFrames() = %q, want %q", got, want)
+	}
+}
+
+// compositeGIF returns the canvas after each frame of g is drawn, in the
+// form returned by canvasString.
+func compositeGIF(t *testing.T, g *gif.GIF) []string {
+	t.Helper()
+	src, err := NewGIFSource(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return compositeSource(t, src)
+}
+
+// compositeSource returns the canvas after each frame of src is drawn, in
+// the form returned by canvasString.
+func compositeSource(t *testing.T, src FrameSource) []string {
+	t.Helper()
+	var got []string
+	err := compositeFrames(src, func(_ int, canvas *image.RGBA, _ Frame) error {
+		got = append(got, canvasString(canvas))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("compositeFrames() returned unexpected error: %v", err)
+	}
+	return got
+}
+
+// canvasString returns the pixels of img in the form used by
+// TestCompositeFrames.
+func canvasString(img *image.RGBA) string {
+	names := map[color.RGBA]byte{
+		{0xff, 0x00, 0x00, 0xff}: 'R',
+		{0x00, 0xff, 0x00, 0xff}: 'G',
+		{0x00, 0x00, 0xff, 0xff}: 'B',
+		{0xff, 0xff, 0xff, 0xff}: 'W',
+		{0x00, 0x00, 0x00, 0xff}: 'K',
+		{}:                       '.',
+	}
+	var b strings.Builder
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		if y > bounds.Min.Y {
+			b.WriteByte(' ')
+		}
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c, ok := names[img.RGBAAt(x, y)]
+			if !ok {
+				c = '?'
+			}
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
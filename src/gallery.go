@@ -0,0 +1,333 @@
+package semigraph
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"slices"
+	"time"
+	"unicode"
+)
+
+// GalleryItem is an image or animation shown in a gallery, with a caption
+// under it.
+type GalleryItem struct {
+	Caption string
+
+	// Image is the picture shown. It is ignored if Frames is set.
+	Image image.Image
+
+	// Frames is an animation to show. Only its first frame is shown unless
+	// [GalleryOptions.Animate] is set.
+	Frames FrameSource
+}
+
+// GalleryOptions configures how a gallery is laid out.
+// A nil *GalleryOptions is valid and uses the defaults.
+type GalleryOptions struct {
+	// Columns is the number of thumbnails in each row. If zero, as many as
+	// fit in the terminal attached to stdout are used, or 4 if it isn't a
+	// terminal.
+	Columns int
+
+	// CellColumns and CellRows are the size of each thumbnail in terminal
+	// cells. Each image is scaled to fit and centered within it. If zero,
+	// they are 24 and 12.
+	CellColumns, CellRows int
+
+	// Padding is the number of blank columns between thumbnails. The rows
+	// of thumbnails are separated by half as many blank lines, rounded up,
+	// since cells are about twice as tall as they are wide.
+	Padding int
+
+	// Animate plays the animations in place. Each loops independently for
+	// as long as the longest one takes to play once.
+	Animate bool
+
+	// Render is used to render each thumbnail. Its Columns, Rows and
+	// FitTerminal are replaced by the size of a thumbnail.
+	Render *RenderOptions
+}
+
+func (o *GalleryOptions) cellSize() (cols, rows int) {
+	cols, rows = 24, 12
+	if o != nil && o.CellColumns > 0 {
+		cols = o.CellColumns
+	}
+	if o != nil && o.CellRows > 0 {
+		rows = o.CellRows
+	}
+	return cols, rows
+}
+
+func (o *GalleryOptions) padding() int {
+	if o == nil {
+		return 0
+	}
+	return max(o.Padding, 0)
+}
+
+func (o *GalleryOptions) columns() int {
+	if o != nil && o.Columns > 0 {
+		return o.Columns
+	}
+	if tc, _, err := terminalSize(os.Stdout); err == nil {
+		cw, _ := o.cellSize()
+		pad := o.padding()
+		return max((tc+pad)/(cw+pad), 1)
+	}
+	return 4
+}
+
+// RenderGallery lays the items out in a grid of fixed size cells with
+// their captions under them, like a contact sheet. The result has a single
+// frame unless opts.Animate is set and some of the items are animated, in
+// which case it can be played with [GIF.Play].
+//
+// An item that fails to render is shown as a blank thumbnail with its
+// caption, and the errors of all such items are joined in the returned
+// error alongside the gallery.
+func RenderGallery(items []GalleryItem, opts *GalleryOptions) (*GIF, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("semigraph: gallery has no items")
+	}
+	cw, ch := opts.cellSize()
+	var ropts RenderOptions
+	if opts != nil && opts.Render != nil {
+		ropts = *opts.Render
+	}
+	ropts.Columns, ropts.Rows, ropts.FitTerminal = cw, ch, false
+	animate := opts != nil && opts.Animate
+
+	thumbs := make([][]*frame, len(items))
+	var errs []error
+	r := NewRenderer(&ropts)
+	var buf bytes.Buffer
+	for i, it := range items {
+		var err error
+		switch {
+		case it.Frames != nil:
+			src := it.Frames
+			if !animate {
+				src = &firstFrame{FrameSource: src}
+			}
+			var g *GIF
+			if g, err = renderFrames(src, &ropts); err == nil {
+				thumbs[i] = g.frames
+			}
+		case it.Image != nil:
+			var fr *frame
+			if fr, err = renderFrame(r, &buf, it.Image, 0); err == nil {
+				thumbs[i] = []*frame{fr}
+			}
+		default:
+			err = errors.New("no image")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("semigraph: rendering %q: %w", it.Caption, err))
+		}
+	}
+
+	l := newGalleryLayout(items, opts.columns(), cw, ch, opts.padding())
+	out := &GIF{}
+	var prev time.Duration
+	times := galleryTimes(thumbs)
+	for k, t := range times {
+		cells := l.compose(thumbs, t)
+		if k > 0 {
+			out.frames[k-1].delay = t - prev
+		}
+		prev = t
+		var contents bytes.Buffer
+		for y := range l.lines {
+			if y > 0 {
+				contents.WriteByte('\n')
+			}
+			ropts.profile().writeCells(&contents, cells[y*l.width:(y+1)*l.width])
+		}
+		fr := newFrame(contents.String(), 0)
+		fr.cells, fr.cols = cells, l.width
+		out.frames = append(out.frames, fr)
+	}
+	if n := len(out.frames); n > 1 {
+		out.frames[n-1].delay = galleryDuration(thumbs) - prev
+	}
+	encodeDeltas(out.frames, ropts.profile())
+	return out, errors.Join(errs...)
+}
+
+// firstFrame is a FrameSource that ends after the first frame of the
+// source it wraps.
+type firstFrame struct {
+	FrameSource
+	done bool
+}
+
+func (s *firstFrame) NextFrame() (Frame, error) {
+	if s.done {
+		return Frame{}, io.EOF
+	}
+	s.done = true
+	return s.FrameSource.NextFrame()
+}
+
+// duration returns how long the frames take to play once.
+func duration(frames []*frame) time.Duration {
+	var d time.Duration
+	for _, f := range frames {
+		d += f.delay
+	}
+	return d
+}
+
+// galleryDuration returns how long the longest of the thumbnails takes to
+// play once.
+func galleryDuration(thumbs [][]*frame) time.Duration {
+	var d time.Duration
+	for _, frames := range thumbs {
+		d = max(d, duration(frames))
+	}
+	return d
+}
+
+// maxGalleryFrames bounds the number of frames in an animated gallery.
+// Thumbnails whose frame delays don't line up can otherwise change frame
+// at so many different times that every one of them can't be kept.
+const maxGalleryFrames = 1000
+
+// galleryTimes returns the times at which any of the thumbnails changes
+// frame while the longest plays once, in order and starting from zero.
+// If there are more than maxGalleryFrames of them, evenly spaced times are
+// returned instead, and each thumbnail shows the frame it is on at each.
+func galleryTimes(thumbs [][]*frame) []time.Duration {
+	total := galleryDuration(thumbs)
+	times := []time.Duration{0}
+	for _, frames := range thumbs {
+		d := duration(frames)
+		if len(frames) < 2 || d == 0 {
+			continue
+		}
+		var t time.Duration
+		for i := 0; t < total; i++ {
+			if len(times) > 2*maxGalleryFrames {
+				// Drop the times that repeat, and give up on keeping them
+				// all if there are still too many.
+				times = slices.Compact(slices.Sorted(slices.Values(times)))
+				if len(times) > maxGalleryFrames {
+					return evenTimes(total, maxGalleryFrames)
+				}
+			}
+			times = append(times, t)
+			t += frames[i%len(frames)].delay
+		}
+	}
+	slices.Sort(times)
+	times = slices.Compact(times)
+	if len(times) > maxGalleryFrames {
+		return evenTimes(total, maxGalleryFrames)
+	}
+	return times
+}
+
+// evenTimes returns n times evenly spaced over total, starting from zero.
+func evenTimes(total time.Duration, n int) []time.Duration {
+	times := make([]time.Duration, n)
+	for i := range times {
+		times[i] = total * time.Duration(i) / time.Duration(n)
+	}
+	return times
+}
+
+// frameAt returns the frame shown at time t while the frames loop.
+func frameAt(frames []*frame, t time.Duration) *frame {
+	d := duration(frames)
+	if d == 0 {
+		return frames[0]
+	}
+	t %= d
+	for _, f := range frames {
+		if t < f.delay {
+			return f
+		}
+		t -= f.delay
+	}
+	return frames[len(frames)-1]
+}
+
+// galleryLayout is where the thumbnails and captions of a gallery are
+// placed on a grid of cells.
+type galleryLayout struct {
+	captions     [][]rune
+	cols         int // Thumbnails per row.
+	cw, ch       int // The size of a thumbnail.
+	pad, gap     int // Blank columns and lines between thumbnails.
+	captionLines int
+	width, lines int
+}
+
+func newGalleryLayout(items []GalleryItem, cols, cw, ch, pad int) *galleryLayout {
+	l := &galleryLayout{cols: min(cols, len(items)), cw: cw, ch: ch, pad: pad, gap: (pad + 1) / 2}
+	l.captions = make([][]rune, len(items))
+	for i, it := range items {
+		l.captions[i] = truncateCaption(it.Caption, cw)
+		if len(l.captions[i]) > 0 {
+			l.captionLines = 1
+		}
+	}
+	rows := (len(items) + l.cols - 1) / l.cols
+	l.width = l.cols*cw + (l.cols-1)*pad
+	l.lines = rows*(ch+l.captionLines) + (rows-1)*l.gap
+	return l
+}
+
+// compose returns the cells of the gallery with the frame of each
+// thumbnail shown at time t.
+func (l *galleryLayout) compose(thumbs [][]*frame, t time.Duration) []styledCell {
+	blank := styledCell{r: ' ', fg: Transparent, bg: Transparent}
+	cells := make([]styledCell, l.width*l.lines)
+	for i := range cells {
+		cells[i] = blank
+	}
+	for i, frames := range thumbs {
+		x0 := i % l.cols * (l.cw + l.pad)
+		y0 := i / l.cols * (l.ch + l.captionLines + l.gap)
+		// Thumbnails that failed to render are left blank.
+		if len(frames) > 0 {
+			f := frameAt(frames, t)
+			fw, fh := min(f.cols, l.cw), 0
+			if f.cols > 0 {
+				fh = min(len(f.cells)/f.cols, l.ch)
+			}
+			// Center the thumbnail in its cell.
+			ox, oy := x0+(l.cw-fw)/2, y0+(l.ch-fh)/2
+			for y := range fh {
+				copy(cells[(oy+y)*l.width+ox:], f.cells[y*f.cols:y*f.cols+fw])
+			}
+		}
+		caption := l.captions[i]
+		cx := x0 + (l.cw-len(caption))/2
+		for j, r := range caption {
+			cells[(y0+l.ch)*l.width+cx+j] = styledCell{r: r, fg: Transparent, bg: Transparent}
+		}
+	}
+	return cells
+}
+
+// truncateCaption returns the runes of s, shortened to at most n with an
+// ellipsis at the end if it is longer. Control characters are dropped so
+// they can't move the cursor.
+func truncateCaption(s string, n int) []rune {
+	var rs []rune
+	for _, r := range s {
+		if !unicode.IsControl(r) {
+			rs = append(rs, r)
+		}
+	}
+	if len(rs) > n {
+		rs = append(rs[:max(n-1, 0)], '…')[:n]
+	}
+	return rs
+}
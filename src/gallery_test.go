@@ -0,0 +1,212 @@
+package semigraph
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGalleryCompose(t *testing.T) {
+	solid := func(c Color, cols, rows int) *frame {
+		f := &frame{cols: cols}
+		for range cols * rows {
+			f.cells = append(f.cells, styledCell{r: ' ', fg: Transparent, bg: c})
+		}
+		return f
+	}
+	red, green, blue := RGB(0xff, 0, 0), RGB(0, 0xff, 0), RGB(0, 0, 0xff)
+	items := []GalleryItem{{Caption: "a"}, {Caption: "bb"}, {Caption: "long\tname"}}
+	thumbs := [][]*frame{
+		{solid(red, 2, 1)},
+		{solid(blue, 2, 2)},
+		{solid(green, 1, 1)},
+	}
+	l := newGalleryLayout(items, 2, 2, 2, 1)
+	cells := l.compose(thumbs, 0)
+
+	names := map[Color]rune{red: 'R', green: 'G', blue: 'B'}
+	var got []string
+	for y := range l.lines {
+		var line strings.Builder
+		for _, c := range cells[y*l.width : (y+1)*l.width] {
+			if n, ok := names[c.bg]; ok {
+				line.WriteRune(n)
+			} else {
+				line.WriteRune(c.r)
+			}
+		}
+		got = append(got, line.String())
+	}
+	want := []string{
+		"RR BB",
+		"   BB",
+		"a  bb",
+		"     ",
+		"G    ",
+		"     ",
+		"l…   ",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("compose() returned unexpected cells:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestGalleryTimes(t *testing.T) {
+	frames := func(delays ...time.Duration) []*frame {
+		var fs []*frame
+		for _, d := range delays {
+			fs = append(fs, &frame{delay: d})
+		}
+		return fs
+	}
+	ms := time.Millisecond
+	thumbs := [][]*frame{
+		frames(0),
+		frames(100*ms, 100*ms),
+		frames(150*ms, 150*ms, 150*ms),
+	}
+	got := galleryTimes(thumbs)
+	want := []time.Duration{0, 100 * ms, 150 * ms, 200 * ms, 300 * ms, 400 * ms}
+	if !slices.Equal(got, want) {
+		t.Errorf("galleryTimes() = %v, want %v", got, want)
+	}
+	if f := frameAt(thumbs[1], 250*ms); f != thumbs[1][0] {
+		t.Errorf("frameAt(250ms) returned frame %d, want 0", slices.Index(thumbs[1], f))
+	}
+
+	// Delays that never line up would change frame every millisecond or
+	// so, which is capped to evenly spaced times.
+	thumbs = [][]*frame{
+		frames(7*ms, 7*ms),
+		frames(11*ms, 11*ms),
+		frames(13*ms, 13*ms, 10*time.Second),
+	}
+	got = galleryTimes(thumbs)
+	if len(got) != maxGalleryFrames || got[0] != 0 || got[1] != 10026*time.Microsecond {
+		t.Errorf("galleryTimes() with too many changes = %d times starting %v, want %d evenly spaced", len(got), got[:2], maxGalleryFrames)
+	}
+}
+
+func TestRenderGallery(t *testing.T) {
+	pal := color.Palette{color.Black, color.White}
+	anim := func(n, delay int) *gif.GIF {
+		g := &gif.GIF{Config: image.Config{Width: 8, Height: 8}}
+		for i := range n {
+			frm := image.NewPaletted(image.Rect(0, 0, 8, 8), pal)
+			frm.SetColorIndex(i, 0, 1)
+			g.Image = append(g.Image, frm)
+			g.Delay = append(g.Delay, delay)
+			g.Disposal = append(g.Disposal, gif.DisposalNone)
+		}
+		return g
+	}
+	items := func() []GalleryItem {
+		return []GalleryItem{
+			{Caption: "still", Image: image.NewRGBA(image.Rect(0, 0, 8, 8))},
+			{Caption: "two", Frames: must(NewGIFSource(anim(2, 10)))},
+			{Caption: "three", Frames: must(NewGIFSource(anim(3, 15)))},
+		}
+	}
+	testCases := []struct {
+		name       string
+		animate    bool
+		wantDelays []time.Duration
+	}{
+		{
+			name:       "first_frame",
+			wantDelays: []time.Duration{0},
+		},
+		{
+			name:    "animated",
+			animate: true,
+			wantDelays: []time.Duration{
+				100 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond,
+				100 * time.Millisecond, 100 * time.Millisecond, 50 * time.Millisecond,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g, err := RenderGallery(items(), &GalleryOptions{
+				Columns:     3,
+				CellColumns: 6,
+				CellRows:    2,
+				Padding:     2,
+				Animate:     tc.animate,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var delays []time.Duration
+			for _, f := range g.frames {
+				delays = append(delays, f.delay)
+				if f.lines != 2 {
+					t.Errorf("frame has %d newlines, want 2", f.lines)
+				}
+			}
+			if !slices.Equal(delays, tc.wantDelays) {
+				t.Errorf("RenderGallery() frame delays = %v, want %v", delays, tc.wantDelays)
+			}
+			got, err := g.RenderFrame(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "still    two    three "
+			if lines := strings.Split(got, "\n"); lines[2] != want {
+				t.Errorf("RenderGallery() captions = %q, want %q", lines[2], want)
+			}
+		})
+	}
+}
+
+// brokenSource is a FrameSource whose frames can't be read.
+type brokenSource struct{}
+
+func (brokenSource) Size() (int, int)          { return 8, 8 }
+func (brokenSource) LoopCount() int            { return 0 }
+func (brokenSource) NextFrame() (Frame, error) { return Frame{}, errors.New("corrupt frame") }
+
+func TestRenderGalleryBadItems(t *testing.T) {
+	items := []GalleryItem{
+		{Caption: "good", Image: image.NewRGBA(image.Rect(0, 0, 8, 8))},
+		{Caption: "broken", Frames: brokenSource{}},
+		{Caption: "empty"},
+	}
+	g, err := RenderGallery(items, &GalleryOptions{Columns: 3, CellColumns: 6, CellRows: 2, Padding: 2})
+	if err == nil {
+		t.Fatal("RenderGallery() with bad items returned nil error")
+	}
+	for _, want := range []string{`"broken": corrupt frame`, `"empty": no image`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("RenderGallery() error %q doesn't contain %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "good") {
+		t.Errorf("RenderGallery() error %q mentions the good item", err)
+	}
+	if g == nil {
+		t.Fatal("RenderGallery() with bad items returned no gallery")
+	}
+	got, err := g.RenderFrame(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(got, "\n")
+	if want := " good   broken  empty "; lines[2] != want {
+		t.Errorf("RenderGallery() captions = %q, want %q", lines[2], want)
+	}
+	if strings.TrimSpace(lines[0][strings.LastIndex(lines[0], "m")+1:]) != "" {
+		t.Errorf("RenderGallery() drew something for the bad items: %q", lines[0])
+	}
+}
+
+func TestRenderGalleryEmpty(t *testing.T) {
+	if _, err := RenderGallery(nil, nil); err == nil {
+		t.Error("RenderGallery(nil) returned nil error")
+	}
+}
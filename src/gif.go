@@ -1,104 +1,180 @@
 package semigraph
 
 import (
+	"bytes"
 	"errors"
-	"fmt"
 	"image"
-	"image/draw"
 	"image/gif"
 	"strings"
+	"sync"
 	"time"
 )
 
 type GIF struct {
 	frames []*frame
+
+	// loopCount is the number of times the frames are repeated after they
+	// are first shown, with the same meaning as in [gif.GIF].
+	loopCount int
 }
 
 type frame struct {
 	delay    time.Duration
 	contents string
 	lines    int
+
+	// cells are the frame's cells, row by row, and cols is the number in
+	// each row. They are only kept until the deltas have been encoded.
+	cells []styledCell
+	cols  int
+
+	// delta redraws the cells that changed since the frame before it.
+	// useDelta is set if it is shorter than contents.
+	delta    string
+	changed  int
+	useDelta bool
 }
 
 // RenderGIF parses the frames of the input GIF into a [GIF] that can be
-// rendered in a terminal using [GIF.Play].
-func RenderGIF(g *gif.GIF) (*GIF, error) {
-	nFrames := len(g.Image)
-
-	if nFrames == 0 {
-		return nil, errors.New("semigraph: GIF has no frames")
-	}
-	if nFrames != len(g.Delay) || nFrames != len(g.Disposal) {
-		return nil, errors.New("semigraph: mismatched GIF frame, disposal, and delay lengths")
+// rendered in a terminal using [GIF.Play]. Each frame is rendered as with
+// [Render] using opts.
+func RenderGIF(g *gif.GIF, opts *RenderOptions) (*GIF, error) {
+	src, err := NewGIFSource(g)
+	if err != nil {
+		return nil, err
 	}
+	return RenderFrames(src, opts)
+}
 
-	out := &GIF{
-		frames: make([]*frame, nFrames),
+// RenderFrames composites the frames read from src and renders them into a
+// [GIF] that can be played with [GIF.Play], whatever format they came
+// from. Each frame is rendered as with [Render] using opts.
+func RenderFrames(src FrameSource, opts *RenderOptions) (*GIF, error) {
+	out, err := renderFrames(src, opts)
+	if err != nil {
+		return nil, err
 	}
-	gBounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
-	prev := image.NewRGBA(gBounds) // Might defer this in case there's only 1 frame.
-	base := image.NewRGBA(gBounds)
-	for i, frm := range g.Image {
-		if i > 0 {
-			draw.Draw(base, gBounds, prev, image.Point{}, draw.Src)
-			draw.Draw(base, gBounds, frm, image.Point{}, draw.Over)
-		} else {
-			draw.Draw(base, frm.Bounds(), frm, image.Point{}, draw.Src)
+	encodeDeltas(out.frames, opts.profile())
+	return out, nil
+}
+
+// renderFrames is RenderFrames without the deltas, so the frames keep
+// their cells.
+func renderFrames(src FrameSource, opts *RenderOptions) (*GIF, error) {
+	out := &GIF{loopCount: src.LoopCount()}
+	if w := opts.workers(); w > 1 {
+		if err := renderFramesParallel(out, src, opts, w); err != nil {
+			return nil, err
 		}
-		contents := Render(base)
-		prev.Pix = clonePix(base.Pix)
-		clear(base.Pix)
-		fr := &frame{
-			contents: contents,
-			delay:    time.Millisecond * time.Duration(g.Delay[i]) * 10,
-			lines:    strings.Count(contents, "\n"),
+	} else {
+		r := NewRenderer(opts)
+		var buf bytes.Buffer
+		err := compositeFrames(src, func(_ int, canvas *image.RGBA, f Frame) error {
+			fr, err := renderFrame(r, &buf, canvas, f.Delay)
+			if err != nil {
+				return err
+			}
+			out.frames = append(out.frames, fr)
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
-		out.frames[i] = fr
 	}
-
+	if len(out.frames) == 0 {
+		return nil, errors.New("semigraph: animation has no frames")
+	}
 	return out, nil
 }
 
-func clonePix(b []uint8) []byte {
-	c := make([]uint8, len(b))
-	copy(c, b)
-	return c
+// renderFrame renders img into a frame shown for delay, using buf as
+// scratch space.
+func renderFrame(r *Renderer, buf *bytes.Buffer, img image.Image, delay time.Duration) (*frame, error) {
+	buf.Reset()
+	var cells []styledCell
+	cols := 0
+	err := r.renderTo(buf, img, func(row []styledCell) {
+		cells = append(cells, row...)
+		cols = len(row)
+	})
+	if err != nil {
+		return nil, err
+	}
+	fr := newFrame(buf.String(), delay)
+	fr.cells, fr.cols = cells, cols
+	return fr, nil
 }
 
-// Play prints the contents of the GIF to the terminal until the returned
-// function is called.
-func (g *GIF) Play() func() {
-	n := len(g.frames)
-	if n == 0 {
-		return nil
+// renderFramesParallel renders the frames of src into out on a pool of
+// workers. The frames are composited in order and handed to the workers
+// as they become free, so at most a few are held in memory at once.
+func renderFramesParallel(out *GIF, src FrameSource, opts *RenderOptions, workers int) error {
+	type job struct {
+		i     int
+		img   *image.RGBA
+		delay time.Duration
 	}
-	fmt.Print("\x1b[2J\x1b[H")
-
-	stop := make(chan struct{})
-	go func() {
-		i := 0
-		for {
-			select {
-			case <-stop:
-				return
-			default:
+	jobs := make(chan job, workers)
+	errs := make([]error, workers+1)
+	// Each worker renders whole frames, so the rows of a frame don't need
+	// to be split up as well.
+	frameOpts := *opts
+	frameOpts.Workers = 0
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for k := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := NewRenderer(&frameOpts)
+			var buf bytes.Buffer
+			for j := range jobs {
+				if errs[k] != nil {
+					continue
+				}
+				fr, err := renderFrame(r, &buf, j.img, j.delay)
+				if err != nil {
+					errs[k] = err
+					continue
+				}
+				mu.Lock()
+				if j.i >= len(out.frames) {
+					out.frames = append(out.frames, make([]*frame, j.i+1-len(out.frames))...)
+				}
+				out.frames[j.i] = fr
+				mu.Unlock()
 			}
-			f := g.frames[i]
-			i++
-			i %= n
-			fmt.Print(f.contents)
-			fmt.Printf("\x1b[%dF", f.lines)
-			time.Sleep(f.delay)
-		}
-	}()
-	return func() {
-		stop <- struct{}{}
-		close(stop)
+		}()
+	}
+	errs[workers] = compositeFrames(src, func(i int, canvas *image.RGBA, f Frame) error {
+		img := *canvas
+		img.Pix = clonePix(canvas.Pix)
+		jobs <- job{i, &img, f.Delay}
+		return nil
+	})
+	close(jobs)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// newFrame returns a frame with the rendered contents shown for delay.
+func newFrame(contents string, delay time.Duration) *frame {
+	return &frame{
+		contents: contents,
+		delay:    delay,
+		lines:    strings.Count(contents, "\n"),
 	}
 }
 
-func (g *GIF) Stop() {
+func clonePix(b []uint8) []byte {
+	c := make([]uint8, len(b))
+	copy(c, b)
+	return c
+}
 
+// NumFrames returns the number of frames in the GIF.
+func (g *GIF) NumFrames() int {
+	return len(g.frames)
 }
 
 func (g *GIF) RenderFrame(n int) (string, error) {
@@ -107,3 +183,32 @@ func (g *GIF) RenderFrame(n int) (string, error) {
 	}
 	return g.frames[n].contents, nil
 }
+
+// FrameStats describes the bytes written to draw a frame of a [GIF].
+type FrameStats struct {
+	// Full is the size in bytes of the whole frame.
+	Full int
+
+	// Delta is the size in bytes of the update from the frame before it,
+	// and Changed is the number of cells the update redraws. The frame
+	// before the first is the last.
+	Delta, Changed int
+
+	// UsesDelta reports whether playing the frame after the one before it
+	// writes the update rather than the whole frame.
+	UsesDelta bool
+}
+
+// Stats returns the sizes of each frame of the GIF.
+func (g *GIF) Stats() []FrameStats {
+	stats := make([]FrameStats, len(g.frames))
+	for i, f := range g.frames {
+		stats[i] = FrameStats{
+			Full:      len(f.contents),
+			Delta:     len(f.delta),
+			Changed:   f.changed,
+			UsesDelta: f.useDelta,
+		}
+	}
+	return stats
+}
@@ -2,8 +2,11 @@ package semigraph
 
 import (
 	"bytes"
+	"image"
+	"image/color"
 	"image/gif"
 	"os"
+	"runtime"
 	"testing"
 )
 
@@ -23,6 +26,92 @@ func BenchmarkRenderGIF(b *testing.B) {
 	b.SetBytes(int64(cfg.Width * cfg.Height))
 	b.ReportAllocs()
 	for b.Loop() {
-		RenderGIF(input)
+		RenderGIF(input, nil)
+	}
+}
+
+func BenchmarkRenderGIFParallel(b *testing.B) {
+	data, err := os.ReadFile("testdata/video-001.gif")
+	if err != nil {
+		b.Fatal(err)
+	}
+	cfg, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		b.Fatal(err)
+	}
+	input, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		b.Fatal(err)
+	}
+	opts := &RenderOptions{Workers: runtime.GOMAXPROCS(0)}
+	b.SetBytes(int64(cfg.Width * cfg.Height))
+	b.ReportAllocs()
+	for b.Loop() {
+		RenderGIF(input, opts)
+	}
+}
+
+func TestRenderGIFParallel(t *testing.T) {
+	data, err := os.ReadFile("testdata/video-001.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := RenderGIF(input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := RenderGIF(input, &RenderOptions{Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range want.frames {
+		if got.frames[i].contents != want.frames[i].contents {
+			t.Errorf("frame %d differs from the serial output", i)
+		}
+	}
+}
+
+func TestRenderGIFGlyphSets(t *testing.T) {
+	pal := color.Palette{color.White, color.Black}
+	frm := image.NewPaletted(image.Rect(0, 0, 2, 2), pal)
+	frm.SetColorIndex(0, 1, 1)
+	frm.SetColorIndex(1, 1, 1)
+	g := &gif.GIF{
+		Image:    []*image.Paletted{frm},
+		Delay:    []int{0},
+		Disposal: []byte{0},
+		Config:   image.Config{Width: 2, Height: 2},
+	}
+	testCases := []struct {
+		glyphs *GlyphSet
+		want   string
+	}{
+		{
+			glyphs: Quadrants,
+			want:   "\x1b[48;5;231;38;5;16m▄\x1b[m",
+		},
+		{
+			glyphs: HalfBlocks,
+			want:   "\x1b[48;5;231;38;5;16m▄\x1b[48;5;231;38;5;16m▄\x1b[m",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.glyphs.Name, func(t *testing.T) {
+			out, err := RenderGIF(g, &RenderOptions{Glyphs: tc.glyphs})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := out.RenderFrame(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("RenderFrame(0) returned unexpected result:\ngot:  %q\nwant: %q", got, tc.want)
+			}
+		})
 	}
 }
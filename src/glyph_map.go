@@ -48,3 +48,71 @@ var blocks = [256]rune{
 	0x02584, 0x1cddb, 0x1cddc, 0x1cddd, 0x1cdde, 0x02599, 0x1cddf, 0x1cde0,
 	0x1cde1, 0x1cde2, 0x0259f, 0x1cde3, 0x02586, 0x1cde4, 0x1cde5, 0x02588,
 }
+
+// sextants is a lookup table for the 2x3 sextant characters in the
+// Symbols for Legacy Computing block, using the same bitmap layout as
+// [blocks].
+//
+//	1 2
+//	3 4
+//	5 6
+//
+// The block only encodes the 60 sextants that are not already in the
+// Block Elements block, so the left half, right half, empty and full
+// cells are filled in from there.
+var sextants = func() [64]rune {
+	var t [64]rune
+	r := rune(0x1fb00)
+	for m := 1; m < 63; m++ {
+		switch m {
+		case 0b010101:
+			t[m] = 0x258c
+		case 0b101010:
+			t[m] = 0x2590
+		default:
+			t[m] = r
+			r++
+		}
+	}
+	t[0] = ' '
+	t[63] = 0x2588
+	return t
+}()
+
+// quadrants is a lookup table for the 2x2 quadrant characters in the
+// Block Elements block, using the same bitmap layout as [blocks].
+//
+//	1 2
+//	3 4
+var quadrants = [16]rune{
+	' ', 0x2598, 0x259d, 0x2580, 0x2596, 0x258c, 0x259e, 0x259b,
+	0x2597, 0x259a, 0x2590, 0x259c, 0x2584, 0x2599, 0x259f, 0x2588,
+}
+
+// halfBlocks is a lookup table for the 1x2 half block characters.
+//
+//	1
+//	2
+var halfBlocks = [4]rune{' ', 0x2580, 0x2584, 0x2588}
+
+// braille is a lookup table for the 2x4 Braille Patterns block, using the
+// same bitmap layout as [blocks].
+//
+// Braille numbers its dots down the left column first, and the bottom
+// row was added later as dots 7 and 8, so the bits have to be shuffled
+// into the Unicode code point order.
+var braille = func() [256]rune {
+	// dots maps a bit in the bitmap to its Braille dot bit.
+	dots := [8]rune{0x01, 0x08, 0x02, 0x10, 0x04, 0x20, 0x40, 0x80}
+	var t [256]rune
+	for m := range 256 {
+		r := rune(0x2800)
+		for i, d := range dots {
+			if m&(1<<i) != 0 {
+				r |= d
+			}
+		}
+		t[m] = r
+	}
+	return t
+}()
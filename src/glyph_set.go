@@ -0,0 +1,186 @@
+package semigraph
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// Fallback controls how a [GlyphSet] draws a cell whose pixel bitmap has
+// no character of its own.
+type Fallback int
+
+const (
+	// FallbackInvert draws the character for the complement of the bitmap
+	// with the foreground and background colors swapped, which is
+	// visually identical. If the complement is also missing, the cell is
+	// drawn as with FallbackNearest.
+	FallbackInvert Fallback = iota
+
+	// FallbackNearest draws the character whose bitmap differs from the
+	// missing one in the fewest pixels.
+	FallbackNearest
+)
+
+// A GlyphSet is the set of characters used to draw terminal cells.
+//
+// Each cell covers a Width x Height block of pixels which are numbered
+// left to right, top to bottom. A character is looked up by a bitmap of
+// the pixels drawn in the foreground color, where the LSB is the top-left
+// pixel.
+type GlyphSet struct {
+	// Name identifies the glyph set, e.g. "octant".
+	Name string
+
+	// Width and Height are the dimensions in pixels of a single cell.
+	Width, Height int
+
+	glyphs []glyph
+	// masks maps each character in the set back to its bitmap.
+	masks map[rune]uint8
+}
+
+// glyph is the resolved character for a cell bitmap.
+type glyph struct {
+	r rune
+	// swap is set if the foreground and background colors have to be
+	// swapped to draw the requested bitmap with r.
+	swap bool
+	// nearest is the closest glyph that doesn't need the colors swapped,
+	// for when the background is transparent and can't be the foreground.
+	nearest rune
+}
+
+var (
+	// Octants draws 2x4 pixel cells using the octant characters added in
+	// Unicode 16.
+	Octants = mustGlyphSet("octant", 2, 4, blocks[:], FallbackInvert)
+
+	// Sextants draws 2x3 pixel cells using the sextant characters from
+	// the Symbols for Legacy Computing block.
+	Sextants = mustGlyphSet("sextant", 2, 3, sextants[:], FallbackInvert)
+
+	// Quadrants draws 2x2 pixel cells using the quadrant characters from
+	// the Block Elements block.
+	Quadrants = mustGlyphSet("quadrant", 2, 2, quadrants[:], FallbackInvert)
+
+	// HalfBlocks draws 1x2 pixel cells using the upper and lower half
+	// block characters, which nearly every terminal font supports.
+	HalfBlocks = mustGlyphSet("half", 1, 2, halfBlocks[:], FallbackInvert)
+
+	// Braille draws 2x4 pixel cells using the Braille Patterns block.
+	Braille = mustGlyphSet("braille", 2, 4, braille[:], FallbackInvert)
+)
+
+var glyphSets = []*GlyphSet{Octants, Sextants, Quadrants, HalfBlocks, Braille}
+
+// LookupGlyphSet returns the built-in glyph set with the given name, or
+// nil if there isn't one.
+func LookupGlyphSet(name string) *GlyphSet {
+	for _, gs := range glyphSets {
+		if gs.Name == name {
+			return gs
+		}
+	}
+	return nil
+}
+
+// NewGlyphSet returns a glyph set for width x height pixel cells.
+//
+// The glyphs slice must have 1<<(width*height) entries, indexed by cell
+// bitmap. A zero entry means there is no character for that bitmap, and
+// it is drawn according to fallback instead. Cells can have at most 8
+// pixels.
+func NewGlyphSet(name string, width, height int, glyphs []rune, fallback Fallback) (*GlyphSet, error) {
+	n := width * height
+	if width < 1 || height < 1 || n > 8 {
+		return nil, errors.New("semigraph: glyph set cells must have between 1 and 8 pixels")
+	}
+	if len(glyphs) != 1<<n {
+		return nil, errors.New("semigraph: glyph set must have one entry per cell bitmap")
+	}
+
+	gs := &GlyphSet{
+		Name:   name,
+		Width:  width,
+		Height: height,
+		glyphs: make([]glyph, len(glyphs)),
+		masks:  make(map[rune]uint8),
+	}
+	full := uint8(len(glyphs) - 1)
+	for m := range glyphs {
+		mask := uint8(m)
+		near, ok := nearestGlyph(glyphs, mask)
+		if !ok {
+			return nil, errors.New("semigraph: glyph set has no glyphs")
+		}
+		g := glyph{r: near, nearest: near}
+		if r := glyphs[^mask&full]; glyphs[m] == 0 && fallback == FallbackInvert && r != 0 {
+			g.r, g.swap = r, true
+		}
+		gs.glyphs[m] = g
+		if glyphs[m] != 0 {
+			gs.masks[glyphs[m]] = mask
+		}
+	}
+	return gs, nil
+}
+
+// nearestGlyph returns the glyph whose bitmap differs from mask in the
+// fewest pixels, which is the glyph for mask itself if there is one.
+func nearestGlyph(glyphs []rune, mask uint8) (rune, bool) {
+	best := -1
+	for c, r := range glyphs {
+		if r == 0 {
+			continue
+		}
+		if best < 0 || bits.OnesCount8(uint8(c)^mask) < bits.OnesCount8(uint8(best)^mask) {
+			best = c
+		}
+	}
+	if best < 0 {
+		return 0, false
+	}
+	return glyphs[best], true
+}
+
+func mustGlyphSet(name string, width, height int, glyphs []rune, fallback Fallback) *GlyphSet {
+	gs, err := NewGlyphSet(name, width, height, glyphs, fallback)
+	if err != nil {
+		panic(err)
+	}
+	return gs
+}
+
+// pixels returns the number of pixels in a cell.
+func (gs *GlyphSet) pixels() int {
+	return gs.Width * gs.Height
+}
+
+// glyph returns the character and colors used to draw a cell whose pixels
+// in mask are fg and the rest bg.
+func (gs *GlyphSet) glyph(mask uint8, fg, bg Color) (rune, Color, Color) {
+	g := gs.glyphs[int(mask)&(len(gs.glyphs)-1)]
+	switch {
+	case !g.swap:
+		return g.r, fg, bg
+	case bg.alpha:
+		return g.nearest, fg, bg
+	default:
+		return g.r, bg, fg
+	}
+}
+
+// Glyph returns the character used to draw a cell with the given bitmap,
+// and whether the foreground and background colors have to be swapped to
+// draw it.
+func (gs *GlyphSet) Glyph(mask uint8) (r rune, swap bool) {
+	g := gs.glyphs[int(mask)&(len(gs.glyphs)-1)]
+	return g.r, g.swap
+}
+
+// Mask returns the bitmap of the pixels r draws in the foreground color,
+// and whether r is one of the set's characters.
+func (gs *GlyphSet) Mask(r rune) (uint8, bool) {
+	m, ok := gs.masks[r]
+	return m, ok
+}
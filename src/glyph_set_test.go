@@ -0,0 +1,127 @@
+package semigraph
+
+import "testing"
+
+func TestNewGlyphSetFallback(t *testing.T) {
+	// Only the empty, left half and top-left quadrant glyphs exist.
+	glyphs := make([]rune, 16)
+	glyphs[0b0000] = ' '
+	glyphs[0b0101] = '▌'
+	glyphs[0b0001] = '▘'
+
+	testCases := []struct {
+		name     string
+		fallback Fallback
+		mask     uint8
+		wantRune rune
+		wantSwap bool
+	}{
+		{
+			name:     "present",
+			fallback: FallbackInvert,
+			mask:     0b0101,
+			wantRune: '▌',
+		},
+		{
+			name:     "invert",
+			fallback: FallbackInvert,
+			mask:     0b1010,
+			wantRune: '▌',
+			wantSwap: true,
+		},
+		{
+			name:     "invert_full",
+			fallback: FallbackInvert,
+			mask:     0b1111,
+			wantRune: ' ',
+			wantSwap: true,
+		},
+		{
+			name:     "invert_missing_complement",
+			fallback: FallbackInvert,
+			mask:     0b0111,
+			wantRune: '▌',
+		},
+		{
+			name:     "nearest",
+			fallback: FallbackNearest,
+			mask:     0b1010,
+			wantRune: ' ',
+		},
+		{
+			name:     "nearest_one_pixel_off",
+			fallback: FallbackNearest,
+			mask:     0b0011,
+			wantRune: '▘',
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gs, err := NewGlyphSet("test", 2, 2, glyphs, tc.fallback)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, swap := gs.Glyph(tc.mask)
+			if r != tc.wantRune || swap != tc.wantSwap {
+				t.Errorf("Glyph(%04b) = (%q, %v), want (%q, %v)", tc.mask, r, swap, tc.wantRune, tc.wantSwap)
+			}
+		})
+	}
+}
+
+func TestNewGlyphSetErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		width, height int
+		glyphs        []rune
+	}{
+		{
+			name:   "too_many_pixels",
+			width:  3,
+			height: 3,
+			glyphs: make([]rune, 512),
+		},
+		{
+			name:   "no_pixels",
+			width:  0,
+			height: 2,
+			glyphs: make([]rune, 1),
+		},
+		{
+			name:   "wrong_table_size",
+			width:  2,
+			height: 2,
+			glyphs: make([]rune, 8),
+		},
+		{
+			name:   "no_glyphs",
+			width:  1,
+			height: 2,
+			glyphs: make([]rune, 4),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewGlyphSet("test", tc.width, tc.height, tc.glyphs, FallbackInvert); err == nil {
+				t.Errorf("NewGlyphSet(%d, %d) returned nil error", tc.width, tc.height)
+			}
+		})
+	}
+}
+
+func TestGlyphSetMask(t *testing.T) {
+	for _, gs := range glyphSets {
+		for m := range 1 << gs.pixels() {
+			r, swap := gs.Glyph(uint8(m))
+			if swap {
+				continue
+			}
+			if got, ok := gs.Mask(r); !ok || got != uint8(m) {
+				t.Errorf("%s: Mask(%U) = %08b, %t, want %08b", gs.Name, r, got, ok, m)
+			}
+		}
+	}
+	if _, ok := Octants.Mask('a'); ok {
+		t.Error("Mask('a') reported a glyph")
+	}
+}
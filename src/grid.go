@@ -0,0 +1,170 @@
+package semigraph
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+)
+
+// Cell is a terminal cell drawn with a character from a [GlyphSet]. The
+// pixels set in Mask are drawn in FG and the rest in BG.
+type Cell struct {
+	Rune   rune
+	FG, BG Color
+	Mask   uint8
+}
+
+// Grid is a rectangle of cells drawn with the same glyph set.
+type Grid struct {
+	// Cols and Rows are the size of the grid in cells.
+	Cols, Rows int
+
+	// Glyphs is the set the cells are drawn with, which gives the size of
+	// each cell in pixels.
+	Glyphs *GlyphSet
+
+	// Cells are the cells of the grid, row by row.
+	Cells []Cell
+}
+
+// RenderGrid renders the img as with [Render], returning its cells
+// instead of the text that draws them.
+func RenderGrid(img image.Image, opts *RenderOptions) (*Grid, error) {
+	return NewRenderer(opts).RenderGrid(img)
+}
+
+// NewGrid returns a grid of cols x rows transparent spaces drawn with gs.
+// If gs is nil, [Octants] is used.
+func NewGrid(cols, rows int, gs *GlyphSet) *Grid {
+	if gs == nil {
+		gs = Octants
+	}
+	g := &Grid{Cols: cols, Rows: rows, Glyphs: gs, Cells: make([]Cell, cols*rows)}
+	for i := range g.Cells {
+		g.Cells[i] = blankCell
+	}
+	return g
+}
+
+// blankCell is a cell the terminal's background shows through.
+var blankCell = Cell{Rune: ' ', FG: Transparent, BG: Transparent}
+
+// Bounds returns the rectangle of cells in the grid.
+func (g *Grid) Bounds() image.Rectangle {
+	return image.Rect(0, 0, g.Cols, g.Rows)
+}
+
+// At returns the cell in column x of row y.
+func (g *Grid) At(x, y int) Cell {
+	return g.Cells[y*g.Cols+x]
+}
+
+// Set replaces the cell in column x of row y. It does nothing if the cell
+// is outside the grid.
+func (g *Grid) Set(x, y int, c Cell) {
+	if image.Pt(x, y).In(g.Bounds()) {
+		g.Cells[y*g.Cols+x] = c
+	}
+}
+
+// Crop returns a copy of the cells of g within r.
+func (g *Grid) Crop(r image.Rectangle) *Grid {
+	r = r.Intersect(g.Bounds())
+	out := &Grid{Cols: r.Dx(), Rows: r.Dy(), Glyphs: g.Glyphs, Cells: make([]Cell, 0, r.Dx()*r.Dy())}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		out.Cells = append(out.Cells, g.Cells[y*g.Cols+r.Min.X:y*g.Cols+r.Max.X]...)
+	}
+	return out
+}
+
+// Draw overlays src onto g with its top left cell at column x of row y.
+// Cells of src that are entirely transparent are skipped so that g shows
+// through, and the transparent background of the rest is filled with the
+// background of the cell under them. Cells that fall outside g are
+// dropped.
+func (g *Grid) Draw(x, y int, src *Grid) {
+	r := src.Bounds().Add(image.Pt(x, y)).Intersect(g.Bounds())
+	for dy := r.Min.Y; dy < r.Max.Y; dy++ {
+		for dx := r.Min.X; dx < r.Max.X; dx++ {
+			c := src.At(dx-x, dy-y)
+			if c.BG.alpha && c.Mask == 0 && src.isBlank(c.Rune) {
+				continue
+			}
+			under := &g.Cells[dy*g.Cols+dx]
+			if c.BG.alpha {
+				c.BG = under.BG
+			}
+			*under = c
+		}
+	}
+}
+
+// isBlank reports whether r draws nothing in the foreground color.
+func (g *Grid) isBlank(r rune) bool {
+	m, ok := g.Glyphs.Mask(r)
+	return r == ' ' || ok && m == 0
+}
+
+// Lines returns the text that draws each row of the grid with the colors
+// in the profile. Each line starts and ends with the terminal's default
+// colors, so they can be placed anywhere on the screen.
+func (g *Grid) Lines(p ColorProfile) []string {
+	lines := make([]string, g.Rows)
+	row := make([]styledCell, g.Cols)
+	var buf bytes.Buffer
+	for y := range g.Rows {
+		for x, c := range g.Cells[y*g.Cols : (y+1)*g.Cols] {
+			row[x] = styledCell{r: c.Rune, fg: p.Convert(c.FG), bg: p.Convert(c.BG)}
+		}
+		buf.Reset()
+		p.writeCells(&buf, row)
+		lines[y] = buf.String()
+	}
+	return lines
+}
+
+// WriteANSI writes the lines of the grid to w separated by newlines, as
+// [Render] does.
+func (g *Grid) WriteANSI(w io.Writer, p ColorProfile) error {
+	_, err := io.WriteString(w, strings.Join(g.Lines(p), "\n"))
+	return err
+}
+
+// String returns the grid drawn in [TrueColor] as with [Grid.WriteANSI].
+func (g *Grid) String() string {
+	return strings.Join(g.Lines(TrueColor), "\n")
+}
+
+// Image returns the pixels the cells stand for, with each cell covering
+// a block of g.Glyphs.Width x g.Glyphs.Height pixels. Transparent colors
+// are left transparent.
+func (g *Grid) Image() *image.RGBA {
+	return g.Raster(g.Glyphs.Width, g.Glyphs.Height)
+}
+
+// Raster returns an image of the grid with each cell cellWidth x
+// cellHeight pixels in size, as a preview of how a terminal draws it. The
+// pixels of each cell are stretched to fill it.
+func (g *Grid) Raster(cellWidth, cellHeight int) *image.RGBA {
+	gs := g.Glyphs
+	img := image.NewRGBA(image.Rect(0, 0, g.Cols*cellWidth, g.Rows*cellHeight))
+	for i, c := range g.Cells {
+		x0, y0 := i%g.Cols*cellWidth, i/g.Cols*cellHeight
+		for y := range cellHeight {
+			py := y * gs.Height / cellHeight
+			for x := range cellWidth {
+				p := py*gs.Width + x*gs.Width/cellWidth
+				col := c.BG
+				if c.Mask&(1<<p) != 0 {
+					col = c.FG
+				}
+				if !col.alpha {
+					img.SetRGBA(x0+x, y0+y, color.RGBA{col.R, col.G, col.B, 0xff})
+				}
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,76 @@
+package semigraph
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGridLines(t *testing.T) {
+	input := drawFn(16, 16, func(x, y int) color.Color {
+		if x > 12 {
+			return color.Transparent
+		}
+		return color.RGBA{uint8(x * 16), uint8(y * 16), 0x80, 0xff}
+	})
+	for _, prof := range []ColorProfile{TrueColor, ANSI256, ANSI16} {
+		opts := &RenderOptions{Profile: prof}
+		g, err := RenderGrid(input, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := render(t, input, opts)
+		if got := strings.Join(g.Lines(prof), "\n"); got != want {
+			t.Errorf("Lines(%v) differs from Render:\ngot:  %q\nwant: %q", prof, got, want)
+		}
+	}
+}
+
+func TestGridCrop(t *testing.T) {
+	g := NewGrid(3, 2, nil)
+	for i := range g.Cells {
+		g.Cells[i].Rune = rune('a' + i)
+	}
+	testCases := []struct {
+		r          image.Rectangle
+		cols, rows int
+		want       string
+	}{
+		{image.Rect(1, 0, 3, 2), 2, 2, "bcef"},
+		{image.Rect(2, 1, 5, 5), 1, 1, "f"},
+		{image.Rect(4, 4, 5, 5), 0, 0, ""},
+	}
+	for _, tc := range testCases {
+		c := g.Crop(tc.r)
+		var got strings.Builder
+		for _, cell := range c.Cells {
+			got.WriteRune(cell.Rune)
+		}
+		if c.Cols != tc.cols || c.Rows != tc.rows || got.String() != tc.want {
+			t.Errorf("Crop(%v) = %dx%d %q, want %dx%d %q", tc.r, c.Cols, c.Rows, got.String(), tc.cols, tc.rows, tc.want)
+		}
+	}
+}
+
+func TestGridDraw(t *testing.T) {
+	red, blue := RGB(0xff, 0, 0), RGB(0, 0, 0xff)
+	dst := NewGrid(3, 1, Quadrants)
+	for i := range dst.Cells {
+		dst.Cells[i] = Cell{Rune: ' ', FG: Transparent, BG: blue}
+	}
+	src := NewGrid(3, 1, Quadrants)
+	src.Set(1, 0, Cell{Rune: '▘', FG: red, BG: Transparent, Mask: 0b0001})
+	src.Set(2, 0, Cell{Rune: 'x', FG: Transparent, BG: Transparent})
+	dst.Draw(1, 0, src)
+
+	want := []Cell{
+		{Rune: ' ', FG: Transparent, BG: blue},
+		{Rune: ' ', FG: Transparent, BG: blue},
+		{Rune: '▘', FG: red, BG: blue, Mask: 0b0001},
+	}
+	if !slices.Equal(dst.Cells, want) {
+		t.Errorf("Draw() = %v, want %v", dst.Cells, want)
+	}
+}
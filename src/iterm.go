@@ -0,0 +1,54 @@
+package semigraph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"strconv"
+)
+
+// RenderITerm writes img to w as an iTerm2 inline image, for terminals
+// that support OSC 1337 such as iTerm2, WezTerm, Konsole and mintty.
+//
+// The image is sent at full resolution as a PNG, and the terminal scales
+// it to fit the cells it would cover if it were scaled to fit Columns and
+// Rows as with [Render], using CellSize to convert cells to pixels.
+// Transparent pixels are composited onto Background if it is set. The
+// glyph set, profile and dithering options are ignored.
+func RenderITerm(w io.Writer, img image.Image, opts *RenderOptions) error {
+	if img == nil {
+		return errors.New("semigraph: nil image")
+	}
+	b := img.Bounds()
+	if b.Empty() {
+		return errors.New("semigraph: empty image")
+	}
+	size := b.Size()
+	if w, h, ok := opts.pixelSize(b, opts.cellSize()); ok {
+		size = image.Pt(w, h)
+	}
+	cols, rows := opts.cellsCovered(size)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, nrgbaPixels(img, opts.background())); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("\x1b]1337;File=inline=1;size=")
+	bw.WriteString(strconv.Itoa(buf.Len()))
+	bw.WriteString(";width=")
+	bw.WriteString(strconv.Itoa(cols))
+	bw.WriteString(";height=")
+	bw.WriteString(strconv.Itoa(rows))
+	bw.WriteString(";preserveAspectRatio=1:")
+	enc := base64.NewEncoder(base64.StdEncoding, bw)
+	enc.Write(buf.Bytes())
+	enc.Close()
+	bw.WriteByte('\a')
+	return bw.Flush()
+}
@@ -0,0 +1,73 @@
+package semigraph
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRenderITerm(t *testing.T) {
+	input := drawFn(40, 30, func(x, y int) color.Color {
+		if x < 20 {
+			return color.Transparent
+		}
+		return color.RGBA{uint8(x), uint8(y), 0x80, 0xff}
+	})
+	testCases := []struct {
+		opts   *RenderOptions
+		header string
+		bg     color.NRGBA
+	}{
+		{
+			opts:   &RenderOptions{CellSize: image.Pt(10, 20)},
+			header: "width=4;height=2;preserveAspectRatio=1",
+		},
+		{
+			opts:   &RenderOptions{Columns: 2, CellSize: image.Pt(10, 20), Background: SolidBackground(RGB(0xff, 0xff, 0xff))},
+			header: "width=2;height=1;preserveAspectRatio=1",
+			bg:     color.NRGBA{0xff, 0xff, 0xff, 0xff},
+		},
+	}
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		if err := RenderITerm(&buf, input, tc.opts); err != nil {
+			t.Fatal(err)
+		}
+		s := buf.String()
+		const prefix = "\x1b]1337;File=inline=1;size="
+		if !strings.HasPrefix(s, prefix) || !strings.HasSuffix(s, "\a") {
+			t.Fatalf("RenderITerm() has unexpected framing: %q", s)
+		}
+		args, data, _ := strings.Cut(s[len(prefix):len(s)-1], ":")
+		size, header, _ := strings.Cut(args, ";")
+		if header != tc.header {
+			t.Errorf("RenderITerm() arguments = %q, want %q", header, tc.header)
+		}
+		raw, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != strconv.Itoa(len(raw)) {
+			t.Errorf("RenderITerm() size = %s, want %d", size, len(raw))
+		}
+		img, err := png.Decode(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The image is sent at full resolution.
+		if !img.Bounds().Eq(input.Bounds()) {
+			t.Fatalf("RenderITerm() image bounds = %v, want %v", img.Bounds(), input.Bounds())
+		}
+		if got := color.NRGBAModel.Convert(img.At(0, 0)); got != tc.bg {
+			t.Errorf("RenderITerm() transparent pixel = %v, want %v", got, tc.bg)
+		}
+		if got, want := color.NRGBAModel.Convert(img.At(30, 5)), (color.NRGBA{30, 5, 0x80, 0xff}); got != want {
+			t.Errorf("RenderITerm() pixel (30, 5) = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package semigraph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kittyChunk is the most base64 payload sent in one graphics command.
+const kittyChunk = 4096
+
+// Kitty draws images with the kitty terminal graphics protocol, which
+// kitty, WezTerm, Ghostty and Konsole support. The zero value is ready to
+// use.
+//
+// Images are scaled to fit Columns and Rows as with [Render], using
+// CellSize to convert cells to pixels. Partially transparent pixels are
+// composited onto Background if it is set, and are otherwise sent as they
+// are. The glyph set, profile and dithering options are ignored.
+type Kitty struct {
+	// ID identifies the image to the terminal. If it is zero, a random ID
+	// is chosen and stored here when the image is first sent. Sending an
+	// image with the ID of an earlier one replaces it.
+	ID uint32
+
+	// PlacementID identifies where the image is placed, if it is not zero.
+	PlacementID uint32
+
+	// ZIndex orders the image relative to text and other images. Images
+	// with a negative z-index are drawn under text.
+	ZIndex int32
+
+	// PNG sends the pixels compressed as a PNG rather than as raw RGBA,
+	// which is smaller but costs time to encode.
+	PNG bool
+
+	// Placeholder places the image with Unicode placeholder characters,
+	// which the terminal replaces with the image. Since they are text,
+	// they can be moved and scrolled by applications such as tmux that
+	// don't know about images. At most 64 rows of cells are supported.
+	Placeholder bool
+
+	// Tmux wraps the commands in tmux's passthrough sequence so that they
+	// reach the terminal tmux is running in. It should be combined with
+	// Placeholder, since tmux can't place images itself.
+	Tmux bool
+}
+
+// Render writes img to w, placing it at the cursor.
+func (k *Kitty) Render(w io.Writer, img image.Image, opts *RenderOptions) error {
+	if img == nil {
+		return errors.New("semigraph: nil image")
+	}
+	pix := kittyPixels(img, opts)
+	bw := bufio.NewWriter(w)
+	if err := k.transmit(bw, pix, opts, true, "a=T"); err != nil {
+		return err
+	}
+	if k.Placeholder {
+		k.writePlaceholders(bw, pix.Bounds(), opts)
+	}
+	return bw.Flush()
+}
+
+// RenderFrames writes the frames of src to w as an animation that the
+// terminal plays by itself, placing it at the cursor. The frames are
+// composited as with [RenderFrames] and loop as src specifies.
+func (k *Kitty) RenderFrames(w io.Writer, src FrameSource, opts *RenderOptions) error {
+	bw := bufio.NewWriter(w)
+	var first time.Duration
+	var bounds image.Rectangle
+	err := compositeFrames(src, func(i int, canvas *image.RGBA, f Frame) error {
+		pix := kittyPixels(canvas, opts)
+		if i == 0 {
+			first, bounds = f.Delay, pix.Bounds()
+			return k.transmit(bw, pix, opts, true, "a=T")
+		}
+		return k.transmit(bw, pix, opts, false, "a=f,z="+strconv.Itoa(kittyGap(f.Delay)))
+	})
+	if err != nil {
+		return err
+	}
+	if bounds.Empty() {
+		return errors.New("semigraph: animation has no frames")
+	}
+	// The gap of the first frame can only be set once it has been sent,
+	// and then the animation is started.
+	id := strconv.FormatUint(uint64(k.ID), 10)
+	k.writeCommand(bw, "a=a,i="+id+",r=1,z="+strconv.Itoa(kittyGap(first))+",q=2", nil)
+	k.writeCommand(bw, "a=a,i="+id+",s=3,v="+strconv.Itoa(kittyLoops(src.LoopCount()))+",q=2", nil)
+	if k.Placeholder {
+		k.writePlaceholders(bw, bounds, opts)
+	}
+	return bw.Flush()
+}
+
+// Delete writes the command that removes the image's placements from the
+// screen and frees its data in the terminal.
+func (k *Kitty) Delete(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	k.writeCommand(bw, fmt.Sprintf("a=d,d=I,i=%d,q=2", k.ID), nil)
+	return bw.Flush()
+}
+
+// transmit sends the pixels of an image or a frame of it with the action
+// in keys, also placing the image if place is set.
+func (k *Kitty) transmit(bw *bufio.Writer, pix *image.NRGBA, opts *RenderOptions, place bool, keys string) error {
+	if k.ID == 0 {
+		k.ID = rand.Uint32N(1<<24-1) + 1
+	}
+	if k.Placeholder && k.ID >= 1<<24 {
+		return errors.New("semigraph: kitty placeholder image IDs must fit in 24 bits")
+	}
+	var ctrl strings.Builder
+	ctrl.WriteString(keys)
+	var payload []byte
+	if k.PNG {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, pix); err != nil {
+			return err
+		}
+		payload = buf.Bytes()
+		ctrl.WriteString(",f=100")
+	} else {
+		payload = pix.Pix
+		fmt.Fprintf(&ctrl, ",f=32,s=%d,v=%d", pix.Bounds().Dx(), pix.Bounds().Dy())
+	}
+	fmt.Fprintf(&ctrl, ",i=%d", k.ID)
+	if place {
+		if k.PlacementID != 0 {
+			fmt.Fprintf(&ctrl, ",p=%d", k.PlacementID)
+		}
+		if k.ZIndex != 0 {
+			fmt.Fprintf(&ctrl, ",z=%d", k.ZIndex)
+		}
+		if k.Placeholder {
+			cols, rows := opts.cellsCovered(pix.Bounds().Size())
+			if rows > len(kittyDiacritics) {
+				return fmt.Errorf("semigraph: kitty placeholders support at most %d rows", len(kittyDiacritics))
+			}
+			fmt.Fprintf(&ctrl, ",U=1,c=%d,r=%d", cols, rows)
+		}
+	}
+	// Don't let the terminal reply, since nothing reads the replies.
+	ctrl.WriteString(",q=2")
+	k.writeCommand(bw, ctrl.String(), payload)
+	return nil
+}
+
+// writeCommand writes a graphics command with the control keys and the
+// payload in base64, split over as many commands as it takes.
+func (k *Kitty) writeCommand(bw *bufio.Writer, ctrl string, payload []byte) {
+	data := base64.StdEncoding.EncodeToString(payload)
+	for first := true; first || len(data) > 0; first = false {
+		var cmd strings.Builder
+		cmd.WriteString("\x1b_G")
+		if first {
+			cmd.WriteString(ctrl)
+		}
+		chunk := data[:min(len(data), kittyChunk)]
+		data = data[len(chunk):]
+		if !first || len(data) > 0 {
+			if first {
+				cmd.WriteByte(',')
+			}
+			if len(data) > 0 {
+				cmd.WriteString("m=1")
+			} else {
+				cmd.WriteString("m=0")
+			}
+		}
+		if chunk != "" {
+			cmd.WriteByte(';')
+			cmd.WriteString(chunk)
+		}
+		cmd.WriteString("\x1b\\")
+		if k.Tmux {
+			bw.WriteString("\x1bPtmux;")
+			bw.WriteString(strings.ReplaceAll(cmd.String(), "\x1b", "\x1b\x1b"))
+			bw.WriteString("\x1b\\")
+		} else {
+			bw.WriteString(cmd.String())
+		}
+	}
+}
+
+// writePlaceholders writes the Unicode placeholder cells for an image of
+// size b. The image ID is carried in the foreground color, the row in a
+// diacritic on the first cell of each row, and the column is left for
+// the terminal to count.
+func (k *Kitty) writePlaceholders(bw *bufio.Writer, b image.Rectangle, opts *RenderOptions) {
+	cols, rows := opts.cellsCovered(b.Size())
+	for y := range rows {
+		if y > 0 {
+			bw.WriteByte('\n')
+		}
+		fmt.Fprintf(bw, "\x1b[38;2;%d;%d;%dm", uint8(k.ID>>16), uint8(k.ID>>8), uint8(k.ID))
+		bw.WriteRune(kittyPlaceholder)
+		bw.WriteRune(kittyDiacritics[y])
+		bw.WriteRune(kittyDiacritics[0])
+		for range cols - 1 {
+			bw.WriteRune(kittyPlaceholder)
+		}
+		bw.WriteString("\x1b[39m")
+	}
+}
+
+// kittyPixels scales img and returns its pixels, composited onto the
+// background if there is one.
+func kittyPixels(img image.Image, opts *RenderOptions) *image.NRGBA {
+	return nrgbaPixels(opts.scalePixels(img), opts.background())
+}
+
+// nrgbaPixels returns the pixels of img composited onto bg, or as they are
+// if bg is nil.
+func nrgbaPixels(img image.Image, bg Background) *image.NRGBA {
+	b := img.Bounds()
+	pix := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	if bg == nil {
+		draw.Draw(pix, pix.Bounds(), img, b.Min, draw.Src)
+		return pix
+	}
+	// The compositor's color lookup only fails for a nil image.
+	at, _ := newColorAtFunc(img, compositor{bg: bg})
+	for y := range b.Dy() {
+		for x := range b.Dx() {
+			if c := at(b.Min.X+x, b.Min.Y+y); !c.alpha {
+				i := pix.PixOffset(x, y)
+				pix.Pix[i], pix.Pix[i+1], pix.Pix[i+2], pix.Pix[i+3] = c.R, c.G, c.B, 0xff
+			}
+		}
+	}
+	return pix
+}
+
+// kittyGap returns the gap in milliseconds before the frame after one
+// shown for d. Kitty treats a gap of zero as unset, so it is at least 1.
+func kittyGap(d time.Duration) int {
+	return max(int(d.Milliseconds()), 1)
+}
+
+// kittyLoops converts a loop count with the meaning of [gif.GIF]'s to the
+// number kitty expects, which is one more than the number of times the
+// animation plays, or 1 to play forever.
+func kittyLoops(loopCount int) int {
+	switch {
+	case loopCount == 0:
+		return 1
+	case loopCount < 0:
+		return 2
+	}
+	return loopCount + 2
+}
+
+// kittyPlaceholder is the character the terminal replaces with a cell of
+// an image.
+const kittyPlaceholder = '\U0010EEEE'
+
+// kittyDiacritics are the combining characters that number the rows and
+// columns of placeholder cells, in the order kitty assigns them.
+var kittyDiacritics = []rune{
+	0x0305, 0x030D, 0x030E, 0x0310, 0x0312, 0x033D, 0x033E, 0x033F,
+	0x0346, 0x034A, 0x034B, 0x034C, 0x0350, 0x0351, 0x0352, 0x0357,
+	0x035B, 0x0363, 0x0364, 0x0365, 0x0366, 0x0367, 0x0368, 0x0369,
+	0x036A, 0x036B, 0x036C, 0x036D, 0x036E, 0x036F, 0x0483, 0x0484,
+	0x0485, 0x0486, 0x0487, 0x0592, 0x0593, 0x0594, 0x0595, 0x0597,
+	0x0598, 0x0599, 0x059C, 0x059D, 0x059E, 0x059F, 0x05A0, 0x05A1,
+	0x05A8, 0x05A9, 0x05AB, 0x05AC, 0x05AF, 0x05C4, 0x0610, 0x0611,
+	0x0612, 0x0613, 0x0614, 0x0615, 0x0616, 0x0617, 0x0657, 0x0658,
+}
@@ -0,0 +1,171 @@
+package semigraph
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"strings"
+	"testing"
+)
+
+// kittyCommand is a graphics command parsed from the output of Kitty.
+type kittyCommand struct {
+	keys    string
+	payload string
+}
+
+// parseKitty splits a stream of graphics commands into the commands and
+// any text that follows them.
+func parseKitty(t *testing.T, s string) ([]kittyCommand, string) {
+	t.Helper()
+	var cmds []kittyCommand
+	for strings.HasPrefix(s, "\x1b_G") {
+		end := strings.Index(s, "\x1b\\")
+		if end < 0 {
+			t.Fatalf("unterminated graphics command: %q", s)
+		}
+		keys, payload, _ := strings.Cut(s[3:end], ";")
+		cmds = append(cmds, kittyCommand{keys, payload})
+		s = s[end+2:]
+	}
+	return cmds, s
+}
+
+func TestKittyRender(t *testing.T) {
+	input := drawFn(2, 1, func(x, _ int) color.Color {
+		if x == 0 {
+			return color.RGBA{0xff, 0x00, 0x00, 0xff}
+		}
+		return color.NRGBA{0x00, 0x00, 0xff, 0x80}
+	})
+	k := &Kitty{ID: 7, PlacementID: 3, ZIndex: -1}
+	var buf bytes.Buffer
+	if err := k.Render(&buf, input, nil); err != nil {
+		t.Fatal(err)
+	}
+	pix := base64.StdEncoding.EncodeToString([]byte{0xff, 0, 0, 0xff, 0, 0, 0xff, 0x80})
+	want := "\x1b_Ga=T,f=32,s=2,v=1,i=7,p=3,z=-1,q=2;" + pix + "\x1b\\"
+	if got := buf.String(); got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	if err := k.Delete(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "\x1b_Ga=d,d=I,i=7,q=2\x1b\\"; got != want {
+		t.Errorf("Delete() = %q, want %q", got, want)
+	}
+}
+
+func TestKittyRenderChunks(t *testing.T) {
+	input := drawFn(40, 40, func(x, y int) color.Color {
+		return color.RGBA{uint8(x), uint8(y), 0x80, 0xff}
+	})
+	var buf bytes.Buffer
+	if err := (&Kitty{ID: 1}).Render(&buf, input, nil); err != nil {
+		t.Fatal(err)
+	}
+	cmds, rest := parseKitty(t, buf.String())
+	if rest != "" {
+		t.Errorf("Render() wrote %q after the commands", rest)
+	}
+	if len(cmds) != 3 {
+		t.Fatalf("Render() wrote %d commands, want 3", len(cmds))
+	}
+	wantKeys := []string{"a=T,f=32,s=40,v=40,i=1,q=2,m=1", "m=1", "m=0"}
+	var data string
+	for i, c := range cmds {
+		if c.keys != wantKeys[i] {
+			t.Errorf("command %d has keys %q, want %q", i, c.keys, wantKeys[i])
+		}
+		if len(c.payload) > 4096 || len(c.payload)%4 != 0 {
+			t.Errorf("command %d has a payload of %d bytes", i, len(c.payload))
+		}
+		data += c.payload
+	}
+	got, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, input.Pix) {
+		t.Error("Render() payload differs from the image's pixels")
+	}
+}
+
+func TestKittyRenderFrames(t *testing.T) {
+	f, err := os.Open("testdata/disposal-none.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.LoopCount = 0
+	g.Delay = []int{10, 20, 0}
+	src, err := NewGIFSource(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := (&Kitty{ID: 9}).RenderFrames(&buf, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	cmds, _ := parseKitty(t, buf.String())
+	want := []string{
+		"a=T,f=32,s=4,v=4,i=9,q=2",
+		"a=f,z=200,f=32,s=4,v=4,i=9,q=2",
+		"a=f,z=1,f=32,s=4,v=4,i=9,q=2",
+		"a=a,i=9,r=1,z=100,q=2",
+		"a=a,i=9,s=3,v=1,q=2",
+	}
+	if len(cmds) != len(want) {
+		t.Fatalf("RenderFrames() wrote %d commands, want %d", len(cmds), len(want))
+	}
+	for i, c := range cmds {
+		if c.keys != want[i] {
+			t.Errorf("command %d has keys %q, want %q", i, c.keys, want[i])
+		}
+	}
+	// The last frame has green and blue corners over the red canvas.
+	last, _ := base64.StdEncoding.DecodeString(cmds[2].payload)
+	if !bytes.Equal(last[:4], []byte{0, 0xff, 0, 0xff}) || !bytes.Equal(last[len(last)-4:], []byte{0, 0, 0xff, 0xff}) {
+		t.Errorf("last frame has unexpected pixels % x", last)
+	}
+}
+
+func TestKittyPlaceholder(t *testing.T) {
+	input := image.NewRGBA(image.Rect(0, 0, 20, 30))
+	k := &Kitty{ID: 0x010203, Placeholder: true, Tmux: true}
+	opts := &RenderOptions{CellSize: image.Pt(10, 20)}
+	var buf bytes.Buffer
+	if err := k.Render(&buf, input, opts); err != nil {
+		t.Fatal(err)
+	}
+	s := buf.String()
+	const prefix = "\x1bPtmux;\x1b\x1b_Ga=T,f=32,s=20,v=30,i=66051,U=1,c=2,r=2,q=2;"
+	if !strings.HasPrefix(s, prefix) {
+		t.Fatalf("Render() = %q, want prefix %q", s, prefix)
+	}
+	_, text, _ := strings.Cut(s, "\x1b\x1b\\\x1b\\")
+	fg := "\x1b[38;2;1;2;3m"
+	want := fg + "\U0010EEEE\u0305\u0305\U0010EEEE\x1b[39m\n" +
+		fg + "\U0010EEEE\u030D\u0305\U0010EEEE\x1b[39m"
+	if text != want {
+		t.Errorf("Render() placeholders = %q, want %q", text, want)
+	}
+
+	tall := &RenderOptions{CellSize: image.Pt(1, 1)}
+	if err := (&Kitty{ID: 1, Placeholder: true}).Render(&buf, input.SubImage(image.Rect(0, 0, 1, 30)), tall); err != nil {
+		t.Errorf("Render() with 30 rows returned unexpected error: %v", err)
+	}
+	tall.Rows = 100
+	if err := (&Kitty{ID: 1, Placeholder: true}).Render(&buf, image.NewRGBA(image.Rect(0, 0, 1, 100)), tall); err == nil {
+		t.Error("Render() with 100 rows returned no error")
+	}
+}
@@ -0,0 +1,538 @@
+package semigraph
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Player plays a [GIF], or the frames played by [PlayFrames], in the
+// terminal. Its methods are safe to call from any goroutine.
+type Player struct {
+	g      *GIF
+	stream *frameStream // Set instead of g by [PlayFrames].
+	w      io.Writer
+	clock  Clock
+	full   bool
+	stop   context.CancelFunc
+	done   chan struct{}
+
+	// wake is signaled whenever the state below changes so the playback
+	// loop can pick it up without waiting out the current frame.
+	wake chan struct{}
+
+	mu     sync.Mutex
+	frame  int
+	paused bool
+	speed  float64
+	plays  int  // The number of times left to play the frames, or 0 for forever.
+	redraw bool // Set when the current frame must be drawn again while paused.
+	err    error
+}
+
+// Clock is the source of time for a [Player], so playback can be driven
+// by something other than the system clock in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After returns a channel that receives the time once d has passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the Clock backed by the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// PlayOptions configures how a GIF is played.
+// A nil *PlayOptions is valid and uses the defaults.
+type PlayOptions struct {
+	// Clock times the frames. If nil, the system clock is used.
+	Clock Clock
+
+	// FullFrames redraws every frame in full. Otherwise, when a frame
+	// follows the one before it, only the cells that changed are redrawn
+	// if that writes fewer bytes.
+	FullFrames bool
+}
+
+func (o *PlayOptions) clock() Clock {
+	if o == nil || o.Clock == nil {
+		return systemClock{}
+	}
+	return o.Clock
+}
+
+// Play starts playing the GIF on stdout and returns the [Player]
+// controlling it. It is PlayTo(ctx, os.Stdout, nil).
+func (g *GIF) Play(ctx context.Context) *Player {
+	return g.PlayTo(ctx, os.Stdout, nil)
+}
+
+// PlayTo starts playing the GIF by writing its frames to w, which is
+// expected to be a terminal, and returns the [Player] controlling it.
+//
+// Each frame is drawn from the start of the line the cursor is on, like
+// [Render]'s output, and the cursor is moved back there afterwards, so
+// anything printed before the GIF stays on the screen. Playback ends when
+// the GIF has been shown as many times as its loop count asks for, when
+// ctx is canceled or [Player.Stop] is called, or when writing to w fails.
+// The cursor is then left on the line below the image.
+func (g *GIF) PlayTo(ctx context.Context, w io.Writer, opts *PlayOptions) *Player {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &Player{
+		g:     g,
+		w:     w,
+		clock: opts.clock(),
+		full:  opts != nil && opts.FullFrames,
+		stop:  cancel,
+		done:  make(chan struct{}),
+		wake:  make(chan struct{}, 1),
+		speed: 1,
+	}
+	switch {
+	case g.loopCount < 0:
+		p.plays = 1
+	case g.loopCount > 0:
+		p.plays = g.loopCount + 1
+	}
+	go p.run(ctx)
+	return p
+}
+
+// streamLookahead is the number of frames [PlayFrames] renders ahead of
+// the one being shown.
+const streamLookahead = 8
+
+// frameStream is the frames of a FrameSource, rendered a few at a time
+// ahead of playback.
+type frameStream struct {
+	frames <-chan *frame
+	err    error // Set before frames is closed if rendering failed.
+	cur    *frame
+	i      int // The index of cur.
+}
+
+// PlayFrames renders the frames of src with opts and plays them by writing
+// them to w as they are rendered, like [GIF.PlayTo] does for a rendered
+// GIF. It returns the [Player] controlling playback.
+//
+// Only a few frames are rendered ahead and none are kept once shown, so
+// it suits long or endless video that [RenderFrames] would have to hold
+// in memory all at once. The flip side is that the frames are shown once,
+// whatever the loop count of src, and [Player.Seek] and stepping with
+// [Player.HandleKeys] aren't supported. If rendering fails, playback ends
+// and [Player.Err] returns the error.
+func PlayFrames(ctx context.Context, w io.Writer, src FrameSource, opts *RenderOptions, popts *PlayOptions) *Player {
+	ctx, cancel := context.WithCancel(ctx)
+	frames := make(chan *frame, streamLookahead)
+	p := &Player{
+		stream: &frameStream{frames: frames, i: -1},
+		w:      w,
+		clock:  popts.clock(),
+		full:   popts != nil && popts.FullFrames,
+		stop:   cancel,
+		done:   make(chan struct{}),
+		wake:   make(chan struct{}, 1),
+		speed:  1,
+	}
+	go func() {
+		defer close(frames)
+		r := NewRenderer(opts)
+		var buf bytes.Buffer
+		var prev []styledCell
+		err := compositeFrames(src, func(_ int, canvas *image.RGBA, f Frame) error {
+			fr, err := renderFrame(r, &buf, canvas, f.Delay)
+			if err != nil {
+				return err
+			}
+			if !p.full && prev != nil {
+				fr.delta, fr.changed = encodeDelta(opts.profile(), prev, fr.cells, fr.cols)
+				fr.useDelta = len(fr.delta) < len(fr.contents)
+			}
+			prev, fr.cells = fr.cells, nil
+			select {
+			case frames <- fr:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			p.stream.err = err
+		}
+	}()
+	go p.run(ctx)
+	return p
+}
+
+func (p *Player) run(ctx context.Context) {
+	defer close(p.done)
+	defer p.stop()
+	if p.stream == nil && len(p.g.frames) == 0 {
+		return
+	}
+
+	// Each frame is timed from when the one before it ended rather than
+	// from when it was written, so the time spent writing doesn't add up
+	// over a loop. Pausing or changing the speed keeps the time the frame
+	// has left, scaled to the new speed.
+	var (
+		start  = p.clock.Now() // When the current frame started.
+		next   time.Time       // When the current frame ends, while playing.
+		left   time.Duration   // How long the current frame has left, while paused.
+		timed  float64         // The speed next or left is for, or 0 if unset.
+		frozen bool            // Whether left is set rather than next.
+		last   *frame
+	)
+	lastIdx := -1
+	for {
+		p.mu.Lock()
+		i := p.frame
+		paused, speed, redraw := p.paused, p.speed, p.redraw
+		p.redraw = false
+		p.mu.Unlock()
+		f, ok := p.frameAt(ctx, i)
+		if !ok {
+			p.finish(last)
+			return
+		}
+
+		if i != lastIdx || redraw {
+			// Only the cells that changed need to be drawn if the frame
+			// before this one is on the screen.
+			prev := i - 1
+			if n := p.numFrames(); n > 0 {
+				prev = (i + n - 1) % n
+			}
+			delta := !p.full && f.useDelta && lastIdx == prev
+			if err := writeFrame(p.w, f, delta); err != nil {
+				p.fail(err)
+				return
+			}
+			if redraw {
+				// A frame that was jumped to is shown for its whole delay.
+				start, timed = p.clock.Now(), 0
+			}
+			last, lastIdx = f, i
+		}
+		if timed == 0 {
+			d := time.Duration(float64(f.delay) / speed)
+			next, left = start.Add(d), d
+			timed, frozen = speed, false
+		}
+		if paused != frozen {
+			if now := p.clock.Now(); paused {
+				left = next.Sub(now)
+			} else {
+				next = now.Add(left)
+			}
+			frozen = paused
+		}
+		if speed != timed {
+			scale := timed / speed
+			if paused {
+				left = time.Duration(float64(left) * scale)
+			} else {
+				now := p.clock.Now()
+				next = now.Add(time.Duration(float64(next.Sub(now)) * scale))
+			}
+			timed = speed
+		}
+		var wait <-chan time.Time
+		if !paused {
+			wait = p.clock.After(next.Sub(p.clock.Now()))
+		}
+
+		select {
+		case <-ctx.Done():
+			p.finish(last)
+			return
+		case <-p.wake:
+		case <-wait:
+			start, timed = next, 0
+			if !p.advance() {
+				p.finish(last)
+				return
+			}
+		}
+	}
+}
+
+// frameAt returns frame i. Streamed frames are waited for, and it returns
+// false if there are no more or ctx is canceled first.
+func (p *Player) frameAt(ctx context.Context, i int) (*frame, bool) {
+	s := p.stream
+	if s == nil {
+		return p.g.frames[i], true
+	}
+	if i != s.i {
+		select {
+		case f, ok := <-s.frames:
+			if !ok {
+				if s.err != nil {
+					p.mu.Lock()
+					p.err = s.err
+					p.mu.Unlock()
+				}
+				return nil, false
+			}
+			s.cur, s.i = f, i
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+	return s.cur, true
+}
+
+// numFrames returns the number of frames that can be sought to, which is
+// none for streamed frames.
+func (p *Player) numFrames() int {
+	if p.stream != nil {
+		return 0
+	}
+	return len(p.g.frames)
+}
+
+// writeFrame draws f and moves the cursor back to where it started. If
+// delta is set, only the cells that changed since the frame before f are
+// drawn.
+func writeFrame(w io.Writer, f *frame, delta bool) error {
+	if delta {
+		_, err := io.WriteString(w, f.delta)
+		return err
+	}
+	if _, err := io.WriteString(w, f.contents); err != nil {
+		return err
+	}
+	var err error
+	if f.lines > 0 {
+		_, err = fmt.Fprintf(w, "\x1b[%dF", f.lines)
+	} else {
+		_, err = io.WriteString(w, "\r")
+	}
+	return err
+}
+
+// finish moves the cursor below the last frame drawn.
+func (p *Player) finish(last *frame) {
+	if last == nil {
+		return
+	}
+	if _, err := fmt.Fprintf(p.w, "\x1b[%dE", last.lines+1); err != nil {
+		p.fail(err)
+	}
+}
+
+// fail records the error that ended playback.
+func (p *Player) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = fmt.Errorf("semigraph: writing frame: %w", err)
+}
+
+// Err returns the error writing or rendering the frames that ended
+// playback, if any.
+// It should be called after [Player.Done] is closed.
+func (p *Player) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// advance moves to the next frame and reports whether there is one.
+func (p *Player) advance() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stream != nil {
+		// The stream ends when its frames run out.
+		p.frame++
+		return true
+	}
+	if p.frame+1 < len(p.g.frames) {
+		p.frame++
+		return true
+	}
+	if p.plays > 0 {
+		p.plays--
+		if p.plays == 0 {
+			return false
+		}
+	}
+	p.frame = 0
+	return true
+}
+
+// update calls fn with the player's state locked and wakes the playback
+// loop to act on the change.
+func (p *Player) update(fn func()) {
+	p.mu.Lock()
+	fn()
+	p.mu.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Pause freezes playback on the current frame.
+func (p *Player) Pause() {
+	p.update(func() { p.paused = true })
+}
+
+// Resume continues playback after [Player.Pause].
+func (p *Player) Resume() {
+	p.update(func() { p.paused = false })
+}
+
+// Paused reports whether playback is paused.
+func (p *Player) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
+
+// Frame returns the index of the frame being shown.
+func (p *Player) Frame() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.frame
+}
+
+// Seek jumps to frame n and draws it, even if playback is paused. It
+// returns an error for frames played by [PlayFrames].
+func (p *Player) Seek(n int) error {
+	if n < 0 || n >= p.numFrames() {
+		return errors.New("semigraph: frame out of bounds")
+	}
+	p.update(func() {
+		p.frame = n
+		p.redraw = true
+	})
+	return nil
+}
+
+// SetSpeed sets how fast the frames are played relative to their delays,
+// so 2 plays twice as fast and 0.5 half as fast. Speeds that aren't
+// positive are ignored.
+func (p *Player) SetSpeed(speed float64) {
+	if !(speed > 0) {
+		return
+	}
+	p.update(func() { p.speed = speed })
+}
+
+// Speed returns the speed set with [Player.SetSpeed].
+func (p *Player) Speed() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.speed
+}
+
+// Stop ends playback and waits for it to finish.
+func (p *Player) Stop() {
+	p.stop()
+	<-p.done
+}
+
+// Done returns a channel that is closed when playback ends.
+func (p *Player) Done() <-chan struct{} {
+	return p.done
+}
+
+// HandleKeys controls playback with the keys read from r until playback
+// ends or r returns an error. r is usually a terminal in raw mode (see
+// [MakeRaw]).
+//
+// Space pauses and resumes, the left and right arrows step back and
+// forward a frame, + and - double and halve the speed, and q or Ctrl-C
+// stop playback.
+//
+// HandleKeys returns as soon as playback ends, even if it is waiting for
+// r. That read carries on in the background, and whatever it returns is
+// discarded.
+func (p *Player) HandleKeys(r io.Reader) error {
+	type chunk struct {
+		keys []byte
+		err  error
+	}
+	chunks := make(chan chunk)
+	go func() {
+		for {
+			buf := make([]byte, 64)
+			n, err := r.Read(buf)
+			select {
+			case chunks <- chunk{buf[:n], err}:
+			case <-p.done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		var c chunk
+		select {
+		case c = <-chunks:
+		case <-p.done:
+			return nil
+		}
+		buf, n := c.keys, len(c.keys)
+		for i := 0; i < n; i++ {
+			switch b := buf[i]; {
+			case b == ' ':
+				if p.Paused() {
+					p.Resume()
+				} else {
+					p.Pause()
+				}
+			case b == '+' || b == '=':
+				p.SetSpeed(p.Speed() * 2)
+			case b == '-':
+				p.SetSpeed(p.Speed() / 2)
+			case b == 'q' || b == 0x03:
+				p.Stop()
+				return nil
+			case b == 0x1b && i+2 < n && buf[i+1] == '[':
+				switch buf[i+2] {
+				case 'C':
+					p.step(1)
+				case 'D':
+					p.step(-1)
+				}
+				i += 2
+			}
+		}
+		if c.err != nil {
+			return c.err
+		}
+	}
+}
+
+// step pauses playback and moves d frames forward, wrapping around at
+// either end.
+func (p *Player) step(d int) {
+	n := p.numFrames()
+	if n == 0 {
+		return
+	}
+	p.update(func() {
+		p.paused = true
+		p.frame = ((p.frame+d)%n + n) % n
+		p.redraw = true
+	})
+}
@@ -0,0 +1,435 @@
+package semigraph
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer that can be written and read concurrently.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// testGIF returns a GIF whose frames are the letters A, B, C and so on.
+func testGIF(n int, delay time.Duration, loopCount int) *GIF {
+	g := &GIF{loopCount: loopCount}
+	for i := range n {
+		g.frames = append(g.frames, &frame{
+			contents: string(rune('A' + i)),
+			delay:    delay,
+		})
+	}
+	return g
+}
+
+func TestPlayerLoopCount(t *testing.T) {
+	testCases := []struct {
+		loopCount int
+		want      string
+	}{
+		{loopCount: -1, want: "ABC"},
+		{loopCount: 1, want: "ABCABC"},
+		{loopCount: 2, want: "ABCABCABC"},
+	}
+	for _, tc := range testCases {
+		var out syncBuffer
+		p := testGIF(3, time.Millisecond, tc.loopCount).PlayTo(context.Background(), &out, nil)
+		select {
+		case <-p.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("loop count %d: playback didn't finish", tc.loopCount)
+		}
+		got := strings.NewReplacer("\r", "", "\x1b[1E", "").Replace(out.String())
+		if got != tc.want {
+			t.Errorf("loop count %d: played %q, want %q", tc.loopCount, got, tc.want)
+		}
+	}
+}
+
+func TestPlayerStop(t *testing.T) {
+	var out syncBuffer
+	p := testGIF(2, time.Hour, 0).PlayTo(context.Background(), &out, nil)
+	p.Stop()
+	select {
+	case <-p.Done():
+	default:
+		t.Error("Done() isn't closed after Stop()")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p = testGIF(2, time.Hour, 0).PlayTo(ctx, &out, nil)
+	cancel()
+	select {
+	case <-p.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("playback didn't stop when the context was canceled")
+	}
+}
+
+func TestPlayerControls(t *testing.T) {
+	var out syncBuffer
+	p := testGIF(3, time.Hour, 0).PlayTo(context.Background(), &out, nil)
+	defer p.Stop()
+
+	p.Pause()
+	if !p.Paused() {
+		t.Error("Paused() = false after Pause()")
+	}
+	if err := p.Seek(2); err != nil {
+		t.Fatalf("Seek(2) returned unexpected error: %v", err)
+	}
+	if err := p.Seek(3); err == nil {
+		t.Error("Seek(3) returned nil error for a 3 frame GIF")
+	}
+	waitFor(t, func() bool { return strings.HasSuffix(out.String(), "C\r") })
+	if got := p.Frame(); got != 2 {
+		t.Errorf("Frame() = %d, want 2", got)
+	}
+
+	p.SetSpeed(4)
+	p.SetSpeed(-1)
+	if got := p.Speed(); got != 4 {
+		t.Errorf("Speed() = %v, want 4", got)
+	}
+}
+
+func TestPlayerHandleKeys(t *testing.T) {
+	var out syncBuffer
+	p := testGIF(3, time.Hour, 0).PlayTo(context.Background(), &out, nil)
+	// Pause, step back twice from the first frame, speed up, then quit.
+	keys := strings.NewReader(" \x1b[D\x1b[D+q")
+	if err := p.HandleKeys(keys); err != nil {
+		t.Fatalf("HandleKeys() returned unexpected error: %v", err)
+	}
+	select {
+	case <-p.Done():
+	default:
+		t.Error("playback didn't stop after q")
+	}
+	if !p.Paused() {
+		t.Error("Paused() = false after space")
+	}
+	if got := p.Frame(); got != 1 {
+		t.Errorf("Frame() = %d, want 1", got)
+	}
+	if got := p.Speed(); got != 2 {
+		t.Errorf("Speed() = %v, want 2", got)
+	}
+}
+
+func TestPlayerHandleKeysReturnsWhenDone(t *testing.T) {
+	var out syncBuffer
+	p := testGIF(3, time.Hour, 0).PlayTo(context.Background(), &out, nil)
+	// The reader never returns, like a terminal nobody types into.
+	r, w := io.Pipe()
+	defer w.Close()
+	errc := make(chan error, 1)
+	go func() { errc <- p.HandleKeys(r) }()
+	p.Stop()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("HandleKeys() returned unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("HandleKeys() didn't return after playback stopped")
+	}
+}
+
+// fakeClock is a Clock that only moves when it is advanced.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []fakeTimer
+	waiting chan struct{} // Receives each time After is called.
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now:     time.Unix(0, 0),
+		waiting: make(chan struct{}, 100),
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := fakeTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	c.waiting <- struct{}{}
+	return t.c
+}
+
+// Advance moves the clock forward by d and fires the timers that are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			timers = append(timers, t)
+			continue
+		}
+		t.c <- c.now
+	}
+	c.timers = timers
+}
+
+func TestPlayToByteStream(t *testing.T) {
+	// Two frames of two lines each: a white cell over a black one, then the
+	// other way around.
+	pal := color.Palette{color.White, color.Black}
+	frm1 := image.NewPaletted(image.Rect(0, 0, 2, 8), pal)
+	frm2 := image.NewPaletted(image.Rect(0, 0, 2, 8), pal)
+	for i := range 8 {
+		frm1.Pix[8+i] = 1
+		frm2.Pix[i] = 1
+	}
+	g, err := RenderGIF(&gif.GIF{
+		Image:     []*image.Paletted{frm1, frm2},
+		Delay:     []int{10, 20},
+		Disposal:  []byte{0, 0},
+		Config:    image.Config{Width: 2, Height: 8},
+		LoopCount: -1,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := newFakeClock()
+	var out syncBuffer
+	p := g.PlayTo(context.Background(), &out, &PlayOptions{Clock: clock})
+
+	white := "\x1b[48;5;231m \x1b[m"
+	black := "\x1b[48;5;16m \x1b[m"
+	want := white + "\n" + black + "\x1b[1F"
+	<-clock.waiting
+	if got := out.String(); got != want {
+		t.Fatalf("PlayTo() wrote unexpected first frame:\ngot:  %q\nwant: %q", got, want)
+	}
+	// The first frame is shown for 100ms, so nothing happens before then.
+	clock.Advance(99 * time.Millisecond)
+	if got := out.String(); got != want {
+		t.Fatalf("PlayTo() wrote the second frame early:\ngot:  %q\nwant: %q", got, want)
+	}
+	clock.Advance(time.Millisecond)
+	<-clock.waiting
+	want += black + "\n" + white + "\x1b[1F"
+	if got := out.String(); got != want {
+		t.Fatalf("PlayTo() wrote unexpected second frame:\ngot:  %q\nwant: %q", got, want)
+	}
+	clock.Advance(200 * time.Millisecond)
+	<-p.Done()
+	want += "\x1b[2E"
+	if got := out.String(); got != want {
+		t.Errorf("PlayTo() wrote unexpected byte stream:\ngot:  %q\nwant: %q", got, want)
+	}
+	if err := p.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
+
+func TestPlayerKeepsTiming(t *testing.T) {
+	clock := newFakeClock()
+	var out syncBuffer
+	p := testGIF(3, time.Second, 0).PlayTo(context.Background(), &out, &PlayOptions{Clock: clock})
+	<-clock.waiting
+	first := out.String()
+
+	// Doubling the speed 400ms in halves the 600ms left, without drawing
+	// the frame again.
+	clock.Advance(400 * time.Millisecond)
+	p.SetSpeed(2)
+	<-clock.waiting
+	if got := out.String(); got != first {
+		t.Errorf("SetSpeed() redrew the frame:\ngot:  %q\nwant: %q", got, first)
+	}
+	clock.Advance(299 * time.Millisecond)
+	if got := p.Frame(); got != 0 {
+		t.Fatalf("Frame() = %d after 299ms of the 300ms left, want 0", got)
+	}
+	clock.Advance(time.Millisecond)
+	<-clock.waiting
+	if got := p.Frame(); got != 1 {
+		t.Fatalf("Frame() = %d after the 300ms left, want 1", got)
+	}
+
+	// Resuming waits for the 400ms the frame had left when it was paused.
+	// The pause and resume may be seen together, so the deadline of the
+	// timer that was set is checked rather than counting timers.
+	clock.Advance(100 * time.Millisecond)
+	p.Pause()
+	p.Resume()
+	<-clock.waiting
+	clock.mu.Lock()
+	deadline := clock.timers[len(clock.timers)-1].at.Sub(clock.now)
+	clock.mu.Unlock()
+	if deadline != 400*time.Millisecond {
+		t.Errorf("after Resume() the frame ends in %v, want 400ms", deadline)
+	}
+	p.Stop()
+}
+
+// endlessSource is an endless video of 2x2 frames that alternate between
+// black and white, each shown for a second. It fails after failAt frames
+// if failAt is set.
+type endlessSource struct {
+	mu     sync.Mutex
+	reads  int
+	failAt int
+}
+
+func (s *endlessSource) Size() (int, int) { return 2, 2 }
+func (s *endlessSource) LoopCount() int   { return -1 }
+
+func (s *endlessSource) NextFrame() (Frame, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failAt > 0 && s.reads == s.failAt {
+		return Frame{}, errors.New("corrupt frame")
+	}
+	c := color.Gray{Y: uint8(s.reads % 2 * 0xff)}
+	s.reads++
+	img := image.NewGray(image.Rect(0, 0, 2, 2))
+	for i := range img.Pix {
+		img.Pix[i] = c.Y
+	}
+	return Frame{Image: img, Delay: time.Second, Op: draw.Src}, nil
+}
+
+func (s *endlessSource) Reads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reads
+}
+
+func TestPlayFrames(t *testing.T) {
+	clock := newFakeClock()
+	src := &endlessSource{}
+	var out syncBuffer
+	p := PlayFrames(context.Background(), &out, src, nil, &PlayOptions{Clock: clock})
+	<-clock.waiting
+	if got := p.Frame(); got != 0 {
+		t.Errorf("Frame() = %d, want 0", got)
+	}
+	// The frame being shown, the frames waiting to be shown and the one
+	// waiting to join them are all that is read.
+	want := streamLookahead + 2
+	waitFor(t, func() bool { return src.Reads() >= want })
+	time.Sleep(10 * time.Millisecond)
+	if got := src.Reads(); got != want {
+		t.Errorf("PlayFrames() read %d frames ahead, want %d", got, want)
+	}
+	if err := p.Seek(0); err == nil {
+		t.Error("Seek(0) returned nil error while playing a stream")
+	}
+
+	first := out.String()
+	clock.Advance(time.Second)
+	<-clock.waiting
+	if got := p.Frame(); got != 1 {
+		t.Errorf("Frame() = %d after a second, want 1", got)
+	}
+	if got := out.String(); got == first {
+		t.Error("PlayFrames() didn't draw the second frame")
+	}
+	waitFor(t, func() bool { return src.Reads() == want+1 })
+	p.Stop()
+	if err := p.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
+
+func TestPlayFramesRenderError(t *testing.T) {
+	clock := newFakeClock()
+	p := PlayFrames(context.Background(), io.Discard, &endlessSource{failAt: 2}, nil, &PlayOptions{Clock: clock})
+	<-clock.waiting
+	clock.Advance(time.Second)
+	<-clock.waiting
+	clock.Advance(time.Second)
+	select {
+	case <-p.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("playback didn't stop when rendering failed")
+	}
+	if err := p.Err(); err == nil || !strings.Contains(err.Error(), "corrupt frame") {
+		t.Errorf("Err() = %v, want the rendering error", err)
+	}
+	if got := p.Frame(); got != 2 {
+		t.Errorf("Frame() = %d, want 2", got)
+	}
+}
+
+// failingWriter fails every write after the first n.
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("broken pipe")
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestPlayToWriteError(t *testing.T) {
+	clock := newFakeClock()
+	p := testGIF(2, time.Second, 0).PlayTo(context.Background(), &failingWriter{n: 3}, &PlayOptions{Clock: clock})
+	<-clock.waiting
+	clock.Advance(time.Second)
+	select {
+	case <-p.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("playback didn't stop after a write failed")
+	}
+	if err := p.Err(); err == nil || !strings.Contains(err.Error(), "broken pipe") {
+		t.Errorf("Err() = %v, want the write error", err)
+	}
+}
+
+// waitFor polls cond until it is true or the test times out.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
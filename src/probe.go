@@ -0,0 +1,154 @@
+package semigraph
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// glyphProbes are the glyph sets tried by ProbeGlyphs, from the most to
+// the least detailed, with a character only that set draws. Half blocks
+// are in every font and aren't probed.
+var glyphProbes = []struct {
+	gs     *GlyphSet
+	sample rune
+}{
+	{Octants, blocks[0b00000100]},
+	{Sextants, sextants[0b000001]},
+	{Quadrants, quadrants[0b0110]},
+}
+
+// cursorReply matches the reply to a cursor position report request.
+var cursorReply = regexp.MustCompile(`\x1b\[([0-9]+);([0-9]+)R`)
+
+// ProbeGlyphs finds the most detailed glyph set that the controlling
+// terminal draws one cell wide. A sample character from each set is
+// printed at the cursor and the terminal is asked where the cursor ended
+// up, waiting at most timeout for each reply. The samples are erased
+// afterwards, leaving the rest of the line as it was.
+//
+// Terminals that treat a set's characters as wide, such as those whose
+// Unicode tables predate the octants, would misalign every row drawn with
+// it. If none of the sets pass, [HalfBlocks] is returned.
+//
+// If id isn't empty, the result is cached under it in the user's cache
+// directory and later calls with the same id return it without probing.
+// The id must identify the terminal program and version, as
+// [Capabilities.ID] does; a name like TERM would share the result between
+// terminals with different fonts and Unicode tables.
+func ProbeGlyphs(id string, timeout time.Duration) (*GlyphSet, error) {
+	var path string
+	if id != "" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			path = filepath.Join(dir, "semigraph", "glyphs.json")
+		}
+	}
+	if gs := cachedGlyphs(path, id); gs != nil {
+		return gs, nil
+	}
+	f, closeTTY, err := openTTY()
+	if err != nil {
+		return nil, err
+	}
+	defer closeTTY()
+	gs, err := probeGlyphs(f, timeout)
+	if err != nil {
+		return nil, err
+	}
+	// The cache only saves time, so failing to write it isn't an error.
+	cacheGlyphs(path, id, gs)
+	return gs, nil
+}
+
+// probeGlyphs probes the glyph sets in glyphProbes on t in order and
+// returns the first one whose sample moves the cursor by one cell.
+//
+// The samples are drawn over each other where the cursor is, which is
+// saved with DECSC first so that each one starts from there, and restored
+// with DECRC at the end to erase only what they drew.
+func probeGlyphs(t tty, timeout time.Duration) (*GlyphSet, error) {
+	reply, err := query(t, "\x1b7\x1b[6n", timeout)
+	if err != nil {
+		return nil, err
+	}
+	row, col, ok := cursorPosition(reply)
+	if !ok {
+		return nil, errNoCursorReport
+	}
+	defer t.Write([]byte("\x1b8\x1b[K"))
+	for _, p := range glyphProbes {
+		reply, err := query(t, "\x1b8"+string(p.sample)+"\x1b[6n", timeout)
+		if err != nil {
+			return nil, err
+		}
+		r, c, ok := cursorPosition(reply)
+		if !ok {
+			return nil, errNoCursorReport
+		}
+		// A sample that wrapped onto the next line doesn't pass either.
+		if r == row && c == col+1 {
+			return p.gs, nil
+		}
+	}
+	return HalfBlocks, nil
+}
+
+var errNoCursorReport = errors.New("semigraph: terminal doesn't report the cursor position")
+
+// cursorPosition returns the row and column in the cursor position report
+// in reply, and whether there is one.
+func cursorPosition(reply []byte) (row, col int, ok bool) {
+	m := cursorReply.FindSubmatch(reply)
+	if m == nil {
+		return 0, 0, false
+	}
+	row, _ = strconv.Atoi(string(m[1]))
+	col, _ = strconv.Atoi(string(m[2]))
+	return row, col, true
+}
+
+// cachedGlyphs returns the glyph set cached in the file at path for the
+// terminal id, or nil if there isn't one.
+func cachedGlyphs(path, id string) *GlyphSet {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var cache map[string]string
+	if json.Unmarshal(data, &cache) != nil {
+		return nil
+	}
+	return LookupGlyphSet(cache[id])
+}
+
+// cacheGlyphs records gs as the glyph set for the terminal id in the
+// file at path, keeping the sets recorded for other terminals.
+func cacheGlyphs(path, id string, gs *GlyphSet) error {
+	if path == "" {
+		return nil
+	}
+	var cache map[string]string
+	if data, err := os.ReadFile(path); err == nil {
+		// A corrupt cache is replaced.
+		json.Unmarshal(data, &cache)
+	}
+	if cache == nil {
+		cache = make(map[string]string)
+	}
+	cache[id] = gs.Name
+	data, err := json.MarshalIndent(cache, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
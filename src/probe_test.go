@@ -0,0 +1,129 @@
+package semigraph
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbeGlyphs(t *testing.T) {
+	start := "\x1b7\x1b[6n"
+	octant, sextant, quadrant := "\x1b8\U0001CD00\x1b[6n", "\x1b8\U0001FB00\x1b[6n", "\x1b8▞\x1b[6n"
+	testCases := []struct {
+		name    string
+		replies map[string]string
+		want    *GlyphSet
+		wantErr bool
+	}{
+		{
+			name: "octants",
+			replies: map[string]string{
+				start:    "\x1b[12;1R",
+				octant:   "\x1b[12;2R",
+				"\x1b[c": fakeDA1,
+			},
+			want: Octants,
+		},
+		{
+			name: "wide_octants",
+			replies: map[string]string{
+				start:    "\x1b[12;1R",
+				octant:   "\x1b[12;3R",
+				sextant:  "\x1b[12;2R",
+				"\x1b[c": fakeDA1,
+			},
+			want: Sextants,
+		},
+		{
+			name: "half_blocks",
+			replies: map[string]string{
+				start:    "\x1b[1;1R",
+				octant:   "\x1b[1;3R",
+				sextant:  "\x1b[1;3R",
+				quadrant: "\x1b[1;3R",
+				"\x1b[c": fakeDA1,
+			},
+			want: HalfBlocks,
+		},
+		{
+			name: "after_prompt",
+			replies: map[string]string{
+				start:    "\x1b[5;10R",
+				octant:   "\x1b[5;11R",
+				"\x1b[c": fakeDA1,
+			},
+			want: Octants,
+		},
+		{
+			name: "wrapped",
+			replies: map[string]string{
+				start:    "\x1b[5;80R",
+				octant:   "\x1b[6;2R",
+				sextant:  "\x1b[6;2R",
+				quadrant: "\x1b[6;2R",
+				"\x1b[c": fakeDA1,
+			},
+			want: HalfBlocks,
+		},
+		{
+			name: "no_cursor_report",
+			replies: map[string]string{
+				"\x1b[c": fakeDA1,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tty := &fakeTTY{replies: tc.replies}
+			got, err := probeGlyphs(tty, time.Second)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("probeGlyphs() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("probeGlyphs() = %v, want %v", got, tc.want)
+			}
+			written := tty.written.String()
+			if strings.Contains(written, "\r") {
+				t.Errorf("probeGlyphs() moved to the start of the line: %q", written)
+			}
+			if !tc.wantErr && !strings.HasSuffix(written, "\x1b8\x1b[K") {
+				t.Errorf("probeGlyphs() didn't erase the samples: %q", written)
+			}
+		})
+	}
+}
+
+func TestGlyphCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "semigraph", "glyphs.json")
+	if gs := cachedGlyphs(path, "kitty"); gs != nil {
+		t.Errorf("cachedGlyphs() with no cache = %v, want nil", gs.Name)
+	}
+	if err := cacheGlyphs(path, "kitty", Octants); err != nil {
+		t.Fatal(err)
+	}
+	if err := cacheGlyphs(path, "xterm", Quadrants); err != nil {
+		t.Fatal(err)
+	}
+	if gs := cachedGlyphs(path, "kitty"); gs != Octants {
+		t.Errorf("cachedGlyphs(kitty) = %v, want octant", gs)
+	}
+	if gs := cachedGlyphs(path, "xterm"); gs != Quadrants {
+		t.Errorf("cachedGlyphs(xterm) = %v, want quadrant", gs)
+	}
+	if gs := cachedGlyphs(path, "foot"); gs != nil {
+		t.Errorf("cachedGlyphs(foot) = %v, want nil", gs.Name)
+	}
+
+	if err := os.WriteFile(path, []byte("null"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cacheGlyphs(path, "foot", Sextants); err != nil {
+		t.Fatal(err)
+	}
+	if gs := cachedGlyphs(path, "foot"); gs != Sextants {
+		t.Errorf("cachedGlyphs(foot) after replacing a corrupt cache = %v, want sextant", gs)
+	}
+}
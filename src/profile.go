@@ -0,0 +1,207 @@
+package semigraph
+
+import (
+	"math"
+	"strings"
+)
+
+// ColorProfile is the range of colors a terminal can display.
+type ColorProfile int
+
+const (
+	// TrueColor displays any 24-bit color.
+	TrueColor ColorProfile = iota
+
+	// ANSI256 displays the xterm 256 color palette. Only the 6x6x6 color
+	// cube and the grayscale ramp are used since the first 16 colors are
+	// usually themed.
+	ANSI256
+
+	// ANSI16 displays the 8 standard and 8 bright ANSI colors.
+	ANSI16
+
+	// ANSI8 displays the 8 standard ANSI colors.
+	ANSI8
+
+	// Monochrome displays only the terminal's foreground and background
+	// colors, which are assumed to be light on dark.
+	Monochrome
+)
+
+// palette is a fixed set of colors indexed by their color code.
+type palette struct {
+	colors []Color
+	labs   []lab
+	// first is the lowest color code that is used.
+	first int
+}
+
+func newPalette(colors []Color, first int) *palette {
+	p := &palette{colors: colors, labs: make([]lab, len(colors)), first: first}
+	for i, c := range colors {
+		p.labs[i] = toOKLab(c)
+	}
+	return p
+}
+
+// nearest returns the code of the color that is perceptually closest to c.
+func (p *palette) nearest(c Color) int {
+	want := toOKLab(c)
+	best, bestDist := p.first, math.Inf(1)
+	for i := p.first; i < len(p.colors); i++ {
+		if d := want.dist(p.labs[i]); d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+var (
+	palette256  = newPalette(xterm256[:], 16)
+	palette16   = newPalette(xterm256[:16], 0)
+	palette8    = newPalette(xterm256[:8], 0)
+	paletteMono = newPalette([]Color{RGB(0x00, 0x00, 0x00), RGB(0xff, 0xff, 0xff)}, 0)
+)
+
+// palette returns the colors available in the profile, or nil if every
+// color is available.
+func (p ColorProfile) palette() *palette {
+	switch p {
+	case ANSI256:
+		return palette256
+	case ANSI16:
+		return palette16
+	case ANSI8:
+		return palette8
+	case Monochrome:
+		return paletteMono
+	}
+	return nil
+}
+
+// Convert returns the color in the profile closest to c.
+func (p ColorProfile) Convert(c Color) Color {
+	pal := p.palette()
+	if c.alpha || pal == nil {
+		return c
+	}
+	return pal.colors[pal.nearest(c)]
+}
+
+// code returns the color code of c, which must be in the profile.
+func (p ColorProfile) code(c Color) int {
+	pal := p.palette()
+	if p == ANSI256 {
+		// The cube and the grayscale ramp can be reversed directly.
+		if v, ok := to8bit(c); ok {
+			return int(v)
+		}
+		if c.R == c.G && c.G == c.B && c.R >= 8 && (c.R-8)%10 == 0 {
+			return 232 + int(c.R-8)/10
+		}
+	}
+	for i := pal.first; i < len(pal.colors); i++ {
+		if pal.colors[i] == c {
+			return i
+		}
+	}
+	return pal.nearest(c)
+}
+
+// WriteStyled writes the foreground and background escape sequence for the
+// profile to buf, as with the package level [WriteStyled]. The colors are
+// converted to the profile first.
+//
+// The 16 and 8 color profiles use the 3x/4x and 9x/10x color codes, and
+// the monochrome profile uses reverse video to swap the terminal's colors
+// when bg is the lighter of the two, or when bg is [Transparent] and fg is
+// dark.
+func (p ColorProfile) WriteStyled(buf *strings.Builder, fg, bg Color) {
+	p.writeStyled(buf, p.Convert(fg), p.Convert(bg))
+}
+
+// writeStyled is WriteStyled for colors already in the profile. It
+// reports whether anything was written.
+func (p ColorProfile) writeStyled(buf ansiWriter, fg, bg Color) bool {
+	if fg.alpha && bg.alpha {
+		return false
+	}
+	switch p {
+	case ANSI16, ANSI8:
+		buf.WriteString("\x1b[")
+		if !bg.alpha {
+			writeANSI16(buf, p.code(bg), 40)
+		}
+		if !fg.alpha {
+			if !bg.alpha {
+				buf.WriteByte(';')
+			}
+			writeANSI16(buf, p.code(fg), 30)
+		}
+		buf.WriteByte('m')
+	case Monochrome:
+		// Reverse video draws the glyph in the terminal's background color
+		// and the rest of the cell in its foreground color. A transparent
+		// background must stay the terminal's, so it is only reversed when
+		// the glyph has to be dark.
+		if bg.alpha && p.code(fg) == 0 || !bg.alpha && p.code(bg) == 1 {
+			buf.WriteString("\x1b[7m")
+		} else {
+			buf.WriteString("\x1b[27m")
+		}
+	default:
+		buf.WriteString("\x1b[")
+		if !bg.alpha {
+			buf.WriteString("48;")
+			p.writeANSI(buf, bg)
+		}
+		if !fg.alpha {
+			if !bg.alpha {
+				buf.WriteByte(';')
+			}
+			buf.WriteString("38;")
+			p.writeANSI(buf, fg)
+		}
+		buf.WriteByte('m')
+	}
+	return true
+}
+
+// writeANSI writes the 8-bit or 24-bit color code for c.
+func (p ColorProfile) writeANSI(buf ansiWriter, c Color) {
+	if p == ANSI256 {
+		buf.WriteString("5;")
+		buf.WriteString(colorLUT[p.code(c)])
+		return
+	}
+	writeANSI(buf, c)
+}
+
+// writeANSI16 writes the SGR parameter for the 16 color code v, where base
+// is 30 for the foreground and 40 for the background.
+func writeANSI16(buf ansiWriter, v, base int) {
+	if v >= 8 {
+		base += 60
+		v -= 8
+	}
+	buf.WriteString(colorLUT[base+v])
+}
+
+// xterm256 is the default xterm 256 color palette.
+var xterm256 = func() [256]Color {
+	p := [256]Color{
+		RGB(0x00, 0x00, 0x00), RGB(0xcd, 0x00, 0x00), RGB(0x00, 0xcd, 0x00), RGB(0xcd, 0xcd, 0x00),
+		RGB(0x00, 0x00, 0xee), RGB(0xcd, 0x00, 0xcd), RGB(0x00, 0xcd, 0xcd), RGB(0xe5, 0xe5, 0xe5),
+		RGB(0x7f, 0x7f, 0x7f), RGB(0xff, 0x00, 0x00), RGB(0x00, 0xff, 0x00), RGB(0xff, 0xff, 0x00),
+		RGB(0x5c, 0x5c, 0xff), RGB(0xff, 0x00, 0xff), RGB(0x00, 0xff, 0xff), RGB(0xff, 0xff, 0xff),
+	}
+	levels := [6]uint8{0x00, 0x5f, 0x87, 0xaf, 0xd7, 0xff}
+	for i := range 216 {
+		p[16+i] = RGB(levels[i/36], levels[i/6%6], levels[i%6])
+	}
+	for i := range 24 {
+		v := uint8(8 + 10*i)
+		p[232+i] = RGB(v, v, v)
+	}
+	return p
+}()
@@ -0,0 +1,173 @@
+package semigraph
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestColorProfileConvert(t *testing.T) {
+	testCases := []struct {
+		profile ColorProfile
+		input   Color
+		want    Color
+	}{
+		{TrueColor, RGB(255, 165, 0), RGB(255, 165, 0)},
+		{ANSI256, RGB(255, 165, 0), RGB(255, 175, 0)},
+		{ANSI256, RGB(0xaf, 0x87, 0x5f), RGB(0xaf, 0x87, 0x5f)},
+		{ANSI256, RGB(20, 20, 20), RGB(18, 18, 18)},
+		{ANSI256, RGB(128, 128, 128), RGB(128, 128, 128)},
+		{ANSI16, RGB(238, 130, 238), RGB(255, 0, 255)},
+		{ANSI16, RGB(200, 200, 200), RGB(229, 229, 229)},
+		{ANSI8, RGB(238, 130, 238), RGB(205, 0, 205)},
+		{ANSI8, RGB(0, 128, 0), RGB(0, 205, 0)},
+		{Monochrome, RGB(20, 20, 20), RGB(0, 0, 0)},
+		{Monochrome, RGB(200, 200, 200), RGB(255, 255, 255)},
+		{ANSI16, Transparent, Transparent},
+	}
+	for _, tc := range testCases {
+		if got := tc.profile.Convert(tc.input); got != tc.want {
+			t.Errorf("ColorProfile(%d).Convert(%v) = %v, want %v", tc.profile, tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestColorProfileWriteStyled(t *testing.T) {
+	testCases := []struct {
+		name    string
+		profile ColorProfile
+		fg, bg  Color
+		want    string
+	}{
+		{
+			name:    "truecolor",
+			profile: TrueColor,
+			fg:      RGB(255, 165, 0),
+			bg:      RGB(0, 0, 0),
+			want:    "\x1b[48;5;16;38;2;255;165;0m",
+		},
+		{
+			name:    "256",
+			profile: ANSI256,
+			fg:      RGB(255, 165, 0),
+			bg:      RGB(200, 200, 200),
+			want:    "\x1b[48;5;251;38;5;214m",
+		},
+		{
+			name:    "256_transparent",
+			profile: ANSI256,
+			fg:      RGB(255, 165, 0),
+			bg:      Transparent,
+			want:    "\x1b[38;5;214m",
+		},
+		{
+			name:    "16",
+			profile: ANSI16,
+			fg:      RGB(238, 130, 238),
+			bg:      RGB(128, 128, 128),
+			want:    "\x1b[100;95m",
+		},
+		{
+			name:    "8",
+			profile: ANSI8,
+			fg:      RGB(238, 130, 238),
+			bg:      RGB(20, 20, 20),
+			want:    "\x1b[40;35m",
+		},
+		{
+			name:    "mono_dark_background",
+			profile: Monochrome,
+			fg:      RGB(200, 200, 200),
+			bg:      RGB(20, 20, 20),
+			want:    "\x1b[27m",
+		},
+		{
+			name:    "mono_light_background",
+			profile: Monochrome,
+			fg:      RGB(20, 20, 20),
+			bg:      RGB(200, 200, 200),
+			want:    "\x1b[7m",
+		},
+		{
+			name:    "mono_transparent_light_foreground",
+			profile: Monochrome,
+			fg:      RGB(200, 200, 200),
+			bg:      Transparent,
+			want:    "\x1b[27m",
+		},
+		{
+			name:    "mono_transparent_dark_foreground",
+			profile: Monochrome,
+			fg:      RGB(20, 20, 20),
+			bg:      Transparent,
+			want:    "\x1b[7m",
+		},
+		{
+			name:    "all_transparent",
+			profile: ANSI16,
+			fg:      Transparent,
+			bg:      Transparent,
+			want:    "",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var b strings.Builder
+			tc.profile.WriteStyled(&b, tc.fg, tc.bg)
+			if got := b.String(); got != tc.want {
+				t.Errorf("WriteStyled(%v, %v) = %q, want %q", tc.fg, tc.bg, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRenderProfile(t *testing.T) {
+	split := drawFn(2, 4, func(_, y int) color.Color {
+		if y < 2 {
+			return color.White
+		}
+		return color.Black
+	})
+	testCases := []struct {
+		name    string
+		profile ColorProfile
+		want    string
+	}{
+		{
+			name:    "256",
+			profile: ANSI256,
+			want:    "\x1b[48;5;231;38;5;16m▄\x1b[m",
+		},
+		{
+			name:    "16",
+			profile: ANSI16,
+			want:    "\x1b[107;30m▄\x1b[m",
+		},
+		{
+			name:    "mono",
+			profile: Monochrome,
+			want:    "\x1b[7m▄\x1b[m",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := render(t, split, &RenderOptions{Profile: tc.profile})
+			if got != tc.want {
+				t.Errorf("Render(img) returned unexpected result:\ngot:  %q\nwant: %q", got, tc.want)
+			}
+		})
+	}
+
+	// Neighboring colors that collapse to the same palette entry are drawn
+	// as a single background color.
+	near := drawFn(2, 4, func(x, _ int) color.Color {
+		if x == 0 {
+			return color.RGBA{0x10, 0x10, 0x10, 0xff}
+		}
+		return color.RGBA{0x14, 0x14, 0x14, 0xff}
+	})
+	want := "\x1b[48;5;233m \x1b[m"
+	if got := render(t, near, &RenderOptions{Profile: ANSI256}); got != want {
+		t.Errorf("Render(img) returned unexpected result:\ngot:  %q\nwant: %q", got, want)
+	}
+}
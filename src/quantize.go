@@ -0,0 +1,86 @@
+package semigraph
+
+import "math"
+
+// Quantizer is a method of splitting the pixels of a cell between its
+// foreground and background colors.
+type Quantizer int
+
+const (
+	// QuantizeMedian sorts the pixels by the color channel with the widest
+	// range and splits them in half. It is fast, but a cell with a few
+	// pixels that stand out is drawn as an even split.
+	QuantizeMedian Quantizer = iota
+
+	// QuantizeOptimal tries every way of splitting the pixels into two
+	// groups and picks the one with the least error in the Oklab
+	// perceptual color space. It keeps small details such as a single
+	// bright pixel, but renders about half as fast.
+	QuantizeOptimal
+)
+
+// quantizeOptimal splits the opaque pixels cs between two colors with the
+// mask that minimizes the squared Oklab distance of each pixel to the
+// mean of its group. The darker group is drawn in the foreground, as
+// with the median split.
+func quantizeOptimal(cs []Color) cell {
+	n := len(cs)
+	var labs [8]lab
+	var sum lab
+	sq := 0.0
+	for i, c := range cs {
+		l := toOKLab(c)
+		labs[i] = l
+		sum = lab{sum.L + l.L, sum.A + l.A, sum.B + l.B}
+		sq += norm2(l)
+	}
+
+	// The error of a split is the sum of squares less n|mean|² for each
+	// group. A mask and its complement split the pixels the same way, so
+	// only masks without the first pixel are tried.
+	full := uint32(1)<<n - 1
+	best, bestErr := uint32(0), math.Inf(1)
+	for m := uint32(2); m < full; m += 2 {
+		var in lab
+		k := 0
+		for i := range n {
+			if m&(1<<i) != 0 {
+				l := labs[i]
+				in = lab{in.L + l.L, in.A + l.A, in.B + l.B}
+				k++
+			}
+		}
+		out := lab{sum.L - in.L, sum.A - in.A, sum.B - in.B}
+		err := sq - norm2(in)/float64(k) - norm2(out)/float64(n-k)
+		if err < bestErr {
+			best, bestErr = m, err
+		}
+	}
+
+	// Partition the pixels into the mask's group and the rest, keeping each
+	// in order, and average them.
+	var fg, bg [8]Color
+	var fgL, bgL float64
+	nf, nb := 0, 0
+	for i, c := range cs {
+		if best&(1<<i) != 0 {
+			fg[nf] = c
+			fgL += labs[i].L
+			nf++
+		} else {
+			bg[nb] = c
+			bgL += labs[i].L
+			nb++
+		}
+	}
+	mask := uint8(best)
+	if fgL/float64(nf) > bgL/float64(nb) {
+		return cell{fg: Average(bg[:nb]), bg: Average(fg[:nf]), mask: ^mask & uint8(full)}
+	}
+	return cell{fg: Average(fg[:nf]), bg: Average(bg[:nb]), mask: mask}
+}
+
+// norm2 returns the squared length of l.
+func norm2(l lab) float64 {
+	return l.L*l.L + l.A*l.A + l.B*l.B
+}
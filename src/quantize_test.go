@@ -0,0 +1,101 @@
+package semigraph
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand/v2"
+	"os"
+	"testing"
+)
+
+func BenchmarkRenderOptimal(b *testing.B) {
+	data, err := os.ReadFile("testdata/benchRGB.png")
+	if err != nil {
+		b.Fatal(err)
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		b.Fatal(err)
+	}
+	input, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		b.Fatal(err)
+	}
+	opts := &RenderOptions{Quantizer: QuantizeOptimal}
+	b.SetBytes(int64(cfg.Width * cfg.Height * 4))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := Render(input, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestQuantizeOptimal(t *testing.T) {
+	dark, bright := RGB(0x10, 0x10, 0x10), RGB(0xff, 0xff, 0xff)
+	// A single bright pixel in the bottom right of a dark cell.
+	at := func(x, y int) Color {
+		if x == 1 && y == 3 {
+			return bright
+		}
+		return dark
+	}
+	cs := make([]Color, 8)
+	testCases := []struct {
+		q    Quantizer
+		want cell
+	}{
+		{
+			q:    QuantizeOptimal,
+			want: cell{fg: dark, bg: bright, mask: 0b01111111},
+		},
+		{
+			// The median split pairs three dark pixels with the bright one.
+			q:    QuantizeMedian,
+			want: cell{fg: dark, bg: Average([]Color{dark, dark, dark, bright}), mask: 0b00001111},
+		},
+	}
+	for _, tc := range testCases {
+		got := quantize(0, 0, 0, 0, Octants, tc.q, at, cs)
+		if !got.fg.equal(tc.want.fg) || !got.bg.equal(tc.want.bg) || got.mask != tc.want.mask {
+			t.Errorf("quantize(%v) = %+v, want %+v", tc.q, got, tc.want)
+		}
+	}
+}
+
+func TestQuantizeOptimalError(t *testing.T) {
+	// The optimal split can never be worse than the median split.
+	rng := rand.New(rand.NewPCG(1, 2))
+	input := drawFn(64, 64, func(x, y int) color.Color {
+		return color.RGBA{uint8(rng.IntN(256)), uint8(rng.IntN(256)), uint8(rng.IntN(256)), 0xff}
+	})
+	cellError := func(q Quantizer) float64 {
+		at, err := NewColorAtFunc(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs := make([]Color, 8)
+		total := 0.0
+		for ty := range 16 {
+			for tx := range 32 {
+				c := quantize(tx, ty, 0, 0, Octants, q, at, cs)
+				for i := range 8 {
+					p := image.Pt(tx*2+i%2, ty*4+i/2)
+					want := at(p.X, p.Y)
+					got := c.bg
+					if c.mask&(1<<i) != 0 {
+						got = c.fg
+					}
+					total += toOKLab(got).dist(toOKLab(want))
+				}
+			}
+		}
+		return total
+	}
+	median, optimal := cellError(QuantizeMedian), cellError(QuantizeOptimal)
+	if optimal > median {
+		t.Errorf("QuantizeOptimal error %f is more than QuantizeMedian error %f", optimal, median)
+	}
+}
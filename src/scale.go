@@ -0,0 +1,292 @@
+package semigraph
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"os"
+)
+
+// Resample is a kernel used to scale an image before it is rendered.
+type Resample int
+
+const (
+	// ResampleBox averages the pixels each output pixel covers. It is the
+	// default since it is cheap and doesn't alias when shrinking.
+	ResampleBox Resample = iota
+
+	// ResampleNearest picks the pixel closest to each output pixel.
+	ResampleNearest
+
+	// ResampleBilinear interpolates linearly between neighboring pixels.
+	ResampleBilinear
+
+	// ResampleLanczos uses a 3-lobed Lanczos window, which keeps edges
+	// sharp at the cost of some ringing.
+	ResampleLanczos
+)
+
+// support returns the radius of the kernel in source pixels at a 1:1 scale.
+func (r Resample) support() float64 {
+	switch r {
+	case ResampleBilinear:
+		return 1
+	case ResampleLanczos:
+		return 3
+	default:
+		return 0.5
+	}
+}
+
+func (r Resample) at(x float64) float64 {
+	x = math.Abs(x)
+	switch r {
+	case ResampleBilinear:
+		if x < 1 {
+			return 1 - x
+		}
+	case ResampleLanczos:
+		if x == 0 {
+			return 1
+		}
+		if x < 3 {
+			px := math.Pi * x
+			return 3 * math.Sin(px) * math.Sin(px/3) / (px * px)
+		}
+	default:
+		if x <= 0.5 {
+			return 1
+		}
+	}
+	return 0
+}
+
+const defaultCellAspect = 2
+
+// cellBounds returns the number of columns and rows the image should
+// fit in, either of which may be zero if it is unbounded.
+func (o *RenderOptions) cellBounds() (cols, rows int) {
+	if o == nil {
+		return 0, 0
+	}
+	cols, rows = o.Columns, o.Rows
+	if o.FitTerminal {
+		if c, r, err := terminalSize(os.Stdout); err == nil {
+			// Leave a row free for the prompt so the image doesn't scroll.
+			cols, rows = c, max(r-1, 1)
+		}
+	}
+	return cols, rows
+}
+
+// cellSize returns the size in pixels of a terminal cell.
+func (o *RenderOptions) cellSize() image.Point {
+	if o != nil && o.CellSize.X > 0 && o.CellSize.Y > 0 {
+		return o.CellSize
+	}
+	if w, h, err := cellPixelSize(os.Stdout); err == nil {
+		return image.Pt(w, h)
+	}
+	aspect := float64(defaultCellAspect)
+	if o != nil && o.CellAspect > 0 {
+		aspect = o.CellAspect
+	}
+	return image.Pt(10, int(math.Round(10*aspect)))
+}
+
+// pixelSize returns the size in pixels the image should be resampled to
+// before it is drawn by a backend that draws pixels, and false if it
+// should be drawn as is. The image keeps its aspect ratio and fits within
+// the columns and rows of cells of the given size.
+func (o *RenderOptions) pixelSize(b image.Rectangle, cell image.Point) (w, h int, ok bool) {
+	cols, rows := o.cellBounds()
+	if (cols <= 0 && rows <= 0) || b.Empty() {
+		return 0, 0, false
+	}
+	scale := math.Inf(1)
+	if cols > 0 {
+		scale = float64(cols*cell.X) / float64(b.Dx())
+	}
+	if rows > 0 {
+		scale = min(scale, float64(rows*cell.Y)/float64(b.Dy()))
+	}
+	w = max(int(math.Round(float64(b.Dx())*scale)), 1)
+	h = max(int(math.Round(float64(b.Dy())*scale)), 1)
+	return w, h, true
+}
+
+// cellsCovered returns the number of cells an image of the given size in
+// pixels covers.
+func (o *RenderOptions) cellsCovered(size image.Point) (cols, rows int) {
+	cell := o.cellSize()
+	return (size.X + cell.X - 1) / cell.X, (size.Y + cell.Y - 1) / cell.Y
+}
+
+// scaledSize returns the size in pixels the image should be resampled to
+// before it is drawn with gs, and false if it should be drawn as is.
+func (o *RenderOptions) scaledSize(b image.Rectangle, gs *GlyphSet) (w, h int, ok bool) {
+	cols, rows := o.cellBounds()
+	if (cols <= 0 && rows <= 0) || b.Empty() {
+		return 0, 0, false
+	}
+
+	aspect := o.CellAspect
+	if aspect <= 0 {
+		aspect = defaultCellAspect
+	}
+	// The image's height in rows if it were cols wide.
+	ratio := float64(b.Dy()) / float64(b.Dx()) / aspect
+	switch {
+	case rows <= 0:
+		rows = int(math.Round(float64(cols) * ratio))
+	case cols <= 0:
+		cols = int(math.Round(float64(rows) / ratio))
+	case float64(cols)*ratio > float64(rows):
+		cols = int(math.Round(float64(rows) / ratio))
+	default:
+		rows = int(math.Round(float64(cols) * ratio))
+	}
+	return max(cols, 1) * gs.Width, max(rows, 1) * gs.Height, true
+}
+
+// scalePixels resamples img to fit Columns and Rows for a backend that
+// draws pixels, or returns it as is if they aren't set.
+func (o *RenderOptions) scalePixels(img image.Image) image.Image {
+	if w, h, ok := o.pixelSize(img.Bounds(), o.cellSize()); ok {
+		var k Resample
+		if o != nil {
+			k = o.Resample
+		}
+		return resample(img, w, h, k)
+	}
+	return img
+}
+
+// resample scales img to w x h pixels using kernel k.
+//
+// The image is filtered in linear light with premultiplied alpha so that
+// dark fringes don't appear around bright or transparent areas.
+func resample(img image.Image, w, h int, k Resample) *image.RGBA {
+	src, ok := img.(*image.RGBA)
+	if !ok {
+		src = image.NewRGBA(img.Bounds())
+		draw.Draw(src, src.Bounds(), img, src.Bounds().Min, draw.Src)
+	}
+	b := src.Bounds()
+	xw := newWeights(b.Dx(), w, k)
+	yw := newWeights(b.Dy(), h, k)
+
+	// Scale each row horizontally, then each column of that vertically.
+	tmp := make([][4]float32, w*b.Dy())
+	for y := range b.Dy() {
+		row := src.Pix[y*src.Stride:]
+		for x, ws := range xw {
+			var acc [4]float32
+			for i, wt := range ws.w {
+				p := row[(ws.start+i)*4:]
+				lin := linearPremul(p[0], p[1], p[2], p[3])
+				for c := range acc {
+					acc[c] += lin[c] * wt
+				}
+			}
+			tmp[y*w+x] = acc
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y, ws := range yw {
+		for x := range w {
+			var acc [4]float32
+			for i, wt := range ws.w {
+				v := tmp[(ws.start+i)*w+x]
+				for c := range acc {
+					acc[c] += v[c] * wt
+				}
+			}
+			p := srgbPremul(acc)
+			copy(dst.Pix[y*dst.Stride+x*4:], p[:])
+		}
+	}
+	return dst
+}
+
+// linearPremul converts a premultiplied sRGB pixel to premultiplied linear
+// light in [0, 1].
+func linearPremul(r, g, b, a uint8) [4]float32 {
+	switch a {
+	case 0:
+		return [4]float32{}
+	case 0xff:
+		return [4]float32{float32(toLinear(r)), float32(toLinear(g)), float32(toLinear(b)), 1}
+	}
+	fa := float32(a) / 0xff
+	unpremul := func(v uint8) float32 {
+		return float32(toLinear(uint8(min(uint32(v)*0xff/uint32(a), 0xff)))) * fa
+	}
+	return [4]float32{unpremul(r), unpremul(g), unpremul(b), fa}
+}
+
+// srgbPremul is the inverse of linearPremul, clamping any overshoot from
+// the kernel.
+func srgbPremul(v [4]float32) [4]uint8 {
+	a := min(max(v[3], 0), 1)
+	if a == 0 {
+		return [4]uint8{}
+	}
+	conv := func(c float32) uint8 {
+		straight := min(max(c/a, 0), 1)
+		return uint8(linearToSRGB(float64(straight))*float64(a)*0xff + 0.5)
+	}
+	return [4]uint8{conv(v[0]), conv(v[1]), conv(v[2]), uint8(a*0xff + 0.5)}
+}
+
+// weights are the source pixels and their weights contributing to a
+// single destination pixel.
+type weights struct {
+	start int
+	w     []float32
+}
+
+func newWeights(srcLen, dstLen int, k Resample) []weights {
+	out := make([]weights, dstLen)
+	scale := float64(srcLen) / float64(dstLen)
+	if k == ResampleNearest {
+		for i := range out {
+			out[i] = weights{start: min(int((float64(i)+0.5)*scale), srcLen-1), w: []float32{1}}
+		}
+		return out
+	}
+
+	// Widen the kernel when shrinking so every source pixel contributes.
+	fs := max(scale, 1)
+	radius := k.support() * fs
+	for i := range out {
+		center := (float64(i)+0.5)*scale - 0.5
+		lo := int(math.Ceil(center - radius))
+		hi := int(math.Floor(center + radius))
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > srcLen-1 {
+			hi = srcLen - 1
+		}
+		ws := make([]float32, 0, hi-lo+1)
+		var sum float64
+		for j := lo; j <= hi; j++ {
+			wt := k.at((float64(j) - center) / fs)
+			ws = append(ws, float32(wt))
+			sum += wt
+		}
+		if sum == 0 {
+			// The kernel fell between source pixels; use the nearest one.
+			j := min(max(int(math.Round(center)), 0), srcLen-1)
+			out[i] = weights{start: j, w: []float32{1}}
+			continue
+		}
+		for j := range ws {
+			ws[j] /= float32(sum)
+		}
+		out[i] = weights{start: lo, w: ws}
+	}
+	return out
+}
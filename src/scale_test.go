@@ -0,0 +1,195 @@
+package semigraph
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestScaledSize(t *testing.T) {
+	testCases := []struct {
+		name   string
+		bounds image.Rectangle
+		opts   *RenderOptions
+		glyphs *GlyphSet
+		wantW  int
+		wantH  int
+		wantOK bool
+	}{
+		{
+			name:   "nil_options",
+			bounds: image.Rect(0, 0, 100, 100),
+			glyphs: Octants,
+		},
+		{
+			name:   "no_size",
+			bounds: image.Rect(0, 0, 100, 100),
+			opts:   &RenderOptions{Resample: ResampleLanczos},
+			glyphs: Octants,
+		},
+		{
+			name:   "columns",
+			bounds: image.Rect(0, 0, 100, 100),
+			opts:   &RenderOptions{Columns: 40},
+			glyphs: Octants,
+			wantW:  80,
+			wantH:  80,
+			wantOK: true,
+		},
+		{
+			name:   "rows",
+			bounds: image.Rect(0, 0, 100, 100),
+			opts:   &RenderOptions{Rows: 20},
+			glyphs: Octants,
+			wantW:  80,
+			wantH:  80,
+			wantOK: true,
+		},
+		{
+			name:   "fit_width",
+			bounds: image.Rect(0, 0, 400, 100),
+			opts:   &RenderOptions{Columns: 40, Rows: 40},
+			glyphs: Octants,
+			wantW:  80,
+			wantH:  20,
+			wantOK: true,
+		},
+		{
+			name:   "fit_height",
+			bounds: image.Rect(0, 0, 100, 400),
+			opts:   &RenderOptions{Columns: 40, Rows: 40},
+			glyphs: Octants,
+			wantW:  40,
+			wantH:  160,
+			wantOK: true,
+		},
+		{
+			name:   "square_cells",
+			bounds: image.Rect(0, 0, 100, 100),
+			opts:   &RenderOptions{Columns: 10, CellAspect: 1},
+			glyphs: Octants,
+			wantW:  20,
+			wantH:  40,
+			wantOK: true,
+		},
+		{
+			name:   "half_blocks",
+			bounds: image.Rect(0, 0, 100, 100),
+			opts:   &RenderOptions{Columns: 10},
+			glyphs: HalfBlocks,
+			wantW:  10,
+			wantH:  10,
+			wantOK: true,
+		},
+		{
+			name:   "at_least_one_cell",
+			bounds: image.Rect(0, 0, 1000, 1),
+			opts:   &RenderOptions{Columns: 10},
+			glyphs: Octants,
+			wantW:  20,
+			wantH:  4,
+			wantOK: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, h, ok := tc.opts.scaledSize(tc.bounds, tc.glyphs)
+			if w != tc.wantW || h != tc.wantH || ok != tc.wantOK {
+				t.Errorf("scaledSize(%v) = (%d, %d, %v), want (%d, %d, %v)", tc.bounds, w, h, ok, tc.wantW, tc.wantH, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestResample(t *testing.T) {
+	checker := drawFn(8, 8, func(x, y int) color.Color {
+		if (x+y)%2 == 0 {
+			return color.Black
+		}
+		return color.White
+	})
+	solid := drawFn(7, 5, func(_, _ int) color.Color {
+		return orange
+	})
+	testCases := []struct {
+		name  string
+		input image.Image
+		w, h  int
+		k     Resample
+		want  color.RGBA
+	}{
+		{
+			name:  "box_checker",
+			input: checker,
+			w:     4,
+			h:     4,
+			k:     ResampleBox,
+			want:  color.RGBA{188, 188, 188, 0xff},
+		},
+		{
+			name:  "nearest_solid",
+			input: solid,
+			w:     13,
+			h:     3,
+			k:     ResampleNearest,
+			want:  orange,
+		},
+		{
+			name:  "bilinear_solid",
+			input: solid,
+			w:     3,
+			h:     11,
+			k:     ResampleBilinear,
+			want:  orange,
+		},
+		{
+			name:  "lanczos_solid",
+			input: solid,
+			w:     20,
+			h:     2,
+			k:     ResampleLanczos,
+			want:  orange,
+		},
+		{
+			name:  "transparent",
+			input: image.NewRGBA(image.Rect(0, 0, 4, 4)),
+			w:     2,
+			h:     2,
+			k:     ResampleLanczos,
+			want:  color.RGBA{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := resample(tc.input, tc.w, tc.h, tc.k)
+			if b := got.Bounds(); b.Dx() != tc.w || b.Dy() != tc.h {
+				t.Fatalf("resample returned a %dx%d image, want %dx%d", b.Dx(), b.Dy(), tc.w, tc.h)
+			}
+			for y := range tc.h {
+				for x := range tc.w {
+					if c := got.RGBAAt(x, y); c != tc.want {
+						t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, c, tc.want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRenderScaled(t *testing.T) {
+	input := drawFn(300, 200, func(x, y int) color.Color {
+		return rainbow[x*len(rainbow)/300]
+	})
+	got := render(t, input, &RenderOptions{Columns: 21, Resample: ResampleBilinear})
+	lines := strings.Split(got, "\n")
+	if len(lines) != 7 {
+		t.Fatalf("Render(img) returned %d lines, want 7", len(lines))
+	}
+	for i, line := range lines {
+		if n := utf8.RuneCountInString(ansiEscape.ReplaceAllString(line, "")); n != 21 {
+			t.Errorf("line %d has %d cells, want 21", i, n)
+		}
+	}
+}
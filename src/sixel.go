@@ -0,0 +1,295 @@
+package semigraph
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"image"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// maxSixelColors is the number of color registers used, which is the most
+// that terminals commonly provide.
+const maxSixelColors = 256
+
+// RenderSixel writes img to w as a DEC Sixel image, for terminals that can
+// display them such as xterm -ti vt340, foot, mlterm and WezTerm.
+//
+// The image is scaled to fit Columns and Rows as with [Render], using
+// CellSize to convert cells to pixels, and transparent pixels are
+// composited onto Background. Pixels that are still transparent are left
+// unpainted so the terminal's background shows through. The glyph set,
+// profile and dithering options are ignored, and the image's colors are
+// reduced to at most 256.
+func RenderSixel(w io.Writer, img image.Image, opts *RenderOptions) error {
+	if img == nil {
+		return errors.New("semigraph: nil image")
+	}
+	img = opts.scalePixels(img)
+	at, err := newColorAtFunc(img, compositor{bg: opts.background()})
+	if err != nil {
+		return err
+	}
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+
+	// Index every pixel into the palette, with -1 for transparent ones.
+	hist := make(map[uint32]int)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if c := at(x, y); !c.alpha {
+				hist[rgbKey(c)]++
+			}
+		}
+	}
+	pal := medianCut(hist, maxSixelColors)
+	lookup := newPaletteLookup(pal)
+	idx := make([]int, width*height)
+	for y := range height {
+		for x := range width {
+			i := -1
+			if c := at(b.Min.X+x, b.Min.Y+y); !c.alpha {
+				i = lookup.index(c)
+			}
+			idx[y*width+x] = i
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	// P2=1 leaves pixels that aren't painted transparent, and the raster
+	// attributes set square pixels and the size of the image.
+	bw.WriteString("\x1bP0;1;0q\"1;1;")
+	bw.WriteString(strconv.Itoa(width))
+	bw.WriteByte(';')
+	bw.WriteString(strconv.Itoa(height))
+	for i, c := range pal {
+		bw.WriteByte('#')
+		bw.WriteString(strconv.Itoa(i))
+		bw.WriteString(";2;")
+		bw.WriteString(strconv.Itoa(percent(c.R)))
+		bw.WriteByte(';')
+		bw.WriteString(strconv.Itoa(percent(c.G)))
+		bw.WriteByte(';')
+		bw.WriteString(strconv.Itoa(percent(c.B)))
+	}
+
+	used := make([]bool, len(pal))
+	row := make([]byte, width)
+	for y0 := 0; y0 < height; y0 += 6 {
+		if y0 > 0 {
+			bw.WriteByte('-')
+		}
+		band := idx[y0*width : min(y0+6, height)*width]
+		clear(used)
+		for _, i := range band {
+			if i >= 0 {
+				used[i] = true
+			}
+		}
+		first := true
+		for c, ok := range used {
+			if !ok {
+				continue
+			}
+			// Each color is drawn over the band from its left edge.
+			if !first {
+				bw.WriteByte('$')
+			}
+			first = false
+			for x := range width {
+				var bits byte
+				for k := 0; k < 6 && (k*width) < len(band); k++ {
+					if band[k*width+x] == c {
+						bits |= 1 << k
+					}
+				}
+				row[x] = '?' + bits
+			}
+			bw.WriteByte('#')
+			bw.WriteString(strconv.Itoa(c))
+			writeSixelRLE(bw, row)
+		}
+	}
+	bw.WriteString("\x1b\\")
+	return bw.Flush()
+}
+
+// writeSixelRLE writes a row of sixels, replacing runs of the same sixel
+// with a repeat introducer. Empty sixels at the end of the row are
+// dropped.
+func writeSixelRLE(bw *bufio.Writer, row []byte) {
+	for len(row) > 0 && row[len(row)-1] == '?' {
+		row = row[:len(row)-1]
+	}
+	for i := 0; i < len(row); {
+		n := 1
+		for i+n < len(row) && row[i+n] == row[i] {
+			n++
+		}
+		if n > 3 {
+			bw.WriteByte('!')
+			bw.WriteString(strconv.Itoa(n))
+			bw.WriteByte(row[i])
+		} else {
+			for range n {
+				bw.WriteByte(row[i])
+			}
+		}
+		i += n
+	}
+}
+
+// percent converts a color channel to the 0-100 range of Sixel colors.
+func percent(v uint8) int {
+	return (int(v)*100 + 127) / 255
+}
+
+// rgbKey packs the channels of c into an integer.
+func rgbKey(c Color) uint32 {
+	return uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+}
+
+// colorBox is a set of colors in the median cut, with how often each
+// appears.
+type colorBox struct {
+	keys   []uint32
+	counts []int
+
+	// ch is the channel with the widest range of values, and rng is the
+	// range.
+	ch, rng int
+}
+
+// channel returns channel ch of a packed color, 0 for red to 2 for blue.
+func channel(key uint32, ch int) uint8 {
+	return uint8(key >> (16 - 8*ch))
+}
+
+// measure finds the channel with the widest range in the box.
+func (b *colorBox) measure() *colorBox {
+	b.rng = -1
+	for ch := range 3 {
+		lo, hi := uint8(255), uint8(0)
+		for _, k := range b.keys {
+			v := channel(k, ch)
+			lo, hi = min(lo, v), max(hi, v)
+		}
+		if r := int(hi) - int(lo); r > b.rng {
+			b.ch, b.rng = ch, r
+		}
+	}
+	return b
+}
+
+// average returns the mean of the colors in the box weighted by how often
+// they appear.
+func (b *colorBox) average() Color {
+	var sum [3]int
+	total := 0
+	for i, k := range b.keys {
+		n := b.counts[i]
+		for ch := range 3 {
+			sum[ch] += int(channel(k, ch)) * n
+		}
+		total += n
+	}
+	return RGB(uint8(sum[0]/total), uint8(sum[1]/total), uint8(sum[2]/total))
+}
+
+// medianCut returns at most n colors that represent the colors in hist.
+// If there are no more than n, they are returned exactly. Otherwise the
+// box of colors with the widest range is split in two at its weighted
+// median until there are n boxes, and each is replaced by its average.
+func medianCut(hist map[uint32]int, n int) []Color {
+	all := &colorBox{}
+	for _, k := range slices.Sorted(maps.Keys(hist)) {
+		all.keys = append(all.keys, k)
+		all.counts = append(all.counts, hist[k])
+	}
+	if len(all.keys) <= n {
+		pal := make([]Color, len(all.keys))
+		for i, k := range all.keys {
+			pal[i] = RGB(channel(k, 0), channel(k, 1), channel(k, 2))
+		}
+		return pal
+	}
+
+	boxes := []*colorBox{all.measure()}
+	for len(boxes) < n {
+		// Only boxes of a single color have a range of zero.
+		split := 0
+		for i, b := range boxes {
+			if b.rng > boxes[split].rng {
+				split = i
+			}
+		}
+		if boxes[split].rng == 0 {
+			break
+		}
+		b := boxes[split]
+		splitCh := b.ch
+		order := make([]int, len(b.keys))
+		for i := range order {
+			order[i] = i
+		}
+		slices.SortFunc(order, func(i, j int) int {
+			return cmp.Compare(channel(b.keys[i], splitCh), channel(b.keys[j], splitCh))
+		})
+		total := 0
+		for _, c := range b.counts {
+			total += c
+		}
+		// Split after the color where half the pixels have been counted,
+		// leaving at least one color on each side.
+		lo, hi := &colorBox{}, &colorBox{}
+		seen := 0
+		for j, i := range order {
+			if j == 0 || seen*2 < total && j < len(order)-1 {
+				lo.keys = append(lo.keys, b.keys[i])
+				lo.counts = append(lo.counts, b.counts[i])
+				seen += b.counts[i]
+				continue
+			}
+			hi.keys = append(hi.keys, b.keys[i])
+			hi.counts = append(hi.counts, b.counts[i])
+		}
+		boxes[split] = lo.measure()
+		boxes = append(boxes, hi.measure())
+	}
+	pal := make([]Color, len(boxes))
+	for i, b := range boxes {
+		pal[i] = b.average()
+	}
+	return pal
+}
+
+// paletteLookup finds the closest color in a palette, remembering the
+// answer for each color it is asked about.
+type paletteLookup struct {
+	pal  []Color
+	memo map[uint32]int
+}
+
+func newPaletteLookup(pal []Color) *paletteLookup {
+	return &paletteLookup{pal: pal, memo: make(map[uint32]int)}
+}
+
+// index returns the index of the palette color closest to c.
+func (l *paletteLookup) index(c Color) int {
+	key := rgbKey(c)
+	if i, ok := l.memo[key]; ok {
+		return i
+	}
+	best, bestDist := 0, -1
+	for i, p := range l.pal {
+		dr, dg, db := int(c.R)-int(p.R), int(c.G)-int(p.G), int(c.B)-int(p.B)
+		if d := dr*dr + dg*dg + db*db; bestDist < 0 || d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	l.memo[key] = best
+	return best
+}
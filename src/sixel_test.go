@@ -0,0 +1,178 @@
+package semigraph
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// decodeSixel decodes a Sixel image as written by RenderSixel, returning
+// its pixels and the number of color registers it defines. Pixels that
+// aren't painted are left transparent.
+func decodeSixel(t *testing.T, data string) (*image.RGBA, int) {
+	t.Helper()
+	const header = "\x1bP0;1;0q\"1;1;"
+	if !strings.HasPrefix(data, header) || !strings.HasSuffix(data, "\x1b\\") {
+		t.Fatalf("Sixel stream has unexpected framing: %q", data)
+	}
+	s := data[len(header) : len(data)-2]
+	num := func() int {
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		v, err := strconv.Atoi(s[:i])
+		if err != nil {
+			t.Fatalf("bad number in Sixel stream at %q", s)
+		}
+		s = s[i:]
+		return v
+	}
+	w := num()
+	s = s[1:]
+	h := num()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	regs := map[int]color.RGBA{}
+	var cur color.RGBA
+	x, y := 0, 0
+	paint := func(ch byte, n int) {
+		for range n {
+			for k := range 6 {
+				if (ch-'?')&(1<<k) != 0 {
+					if !image.Pt(x, y+k).In(img.Bounds()) {
+						t.Fatalf("pixel (%d, %d) is outside the %dx%d image", x, y+k, w, h)
+					}
+					img.SetRGBA(x, y+k, cur)
+				}
+			}
+			x++
+		}
+	}
+	for len(s) > 0 {
+		c := s[0]
+		s = s[1:]
+		switch {
+		case c == '#':
+			i := num()
+			if strings.HasPrefix(s, ";2;") {
+				s = s[3:]
+				var v [3]uint8
+				for j := range 3 {
+					if j > 0 {
+						s = s[1:]
+					}
+					v[j] = uint8((num()*255 + 50) / 100)
+				}
+				regs[i] = color.RGBA{v[0], v[1], v[2], 0xff}
+				continue
+			}
+			cur = regs[i]
+		case c == '!':
+			n := num()
+			ch := s[0]
+			s = s[1:]
+			paint(ch, n)
+		case c == '$':
+			x = 0
+		case c == '-':
+			x, y = 0, y+6
+		case c >= '?' && c <= '~':
+			paint(c, 1)
+		default:
+			t.Fatalf("unexpected byte %q in Sixel stream", c)
+		}
+	}
+	return img, len(regs)
+}
+
+func TestRenderSixel(t *testing.T) {
+	input := drawFn(5, 9, func(x, y int) color.Color {
+		switch {
+		case x == 4 && y == 8:
+			return color.Transparent
+		case y < 3:
+			return color.RGBA{0xff, 0x00, 0x00, 0xff}
+		case x%2 == 0:
+			return color.RGBA{0x12, 0x34, 0x56, 0xff}
+		}
+		return color.RGBA{0xfe, 0xfe, 0xfe, 0xff}
+	})
+	var buf bytes.Buffer
+	if err := RenderSixel(&buf, input, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, regs := decodeSixel(t, buf.String())
+	if regs != 3 {
+		t.Errorf("RenderSixel() defined %d color registers, want 3", regs)
+	}
+	if !got.Bounds().Eq(input.Bounds()) {
+		t.Fatalf("decoded image bounds = %v, want %v", got.Bounds(), input.Bounds())
+	}
+	for y := range 9 {
+		for x := range 5 {
+			if g, w := got.RGBAAt(x, y), input.RGBAAt(x, y); !closeRGBA(g, w, 2) {
+				t.Errorf("pixel (%d, %d) = %v, want %v", x, y, g, w)
+			}
+		}
+	}
+}
+
+func TestRenderSixelPalette(t *testing.T) {
+	input := drawFn(64, 64, func(x, y int) color.Color {
+		return color.RGBA{uint8(x * 4), uint8(y * 4), uint8((x + y) * 2), 0xff}
+	})
+	var buf bytes.Buffer
+	if err := RenderSixel(&buf, input, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, regs := decodeSixel(t, buf.String())
+	if regs > 256 {
+		t.Errorf("RenderSixel() defined %d color registers, want at most 256", regs)
+	}
+	for y := range 64 {
+		for x := range 64 {
+			if g, w := got.RGBAAt(x, y), input.RGBAAt(x, y); !closeRGBA(g, w, 16) {
+				t.Errorf("pixel (%d, %d) = %v, want about %v", x, y, g, w)
+			}
+		}
+	}
+}
+
+func TestRenderSixelRLE(t *testing.T) {
+	input := image.NewRGBA(image.Rect(0, 0, 100, 6))
+	for i := range input.Pix {
+		input.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	if err := RenderSixel(&buf, input, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := "\x1bP0;1;0q\"1;1;100;6#0;2;100;100;100#0!100~\x1b\\"
+	if got := buf.String(); got != want {
+		t.Errorf("RenderSixel() = %q, want %q", got, want)
+	}
+}
+
+func TestRenderSixelScaled(t *testing.T) {
+	input := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	var buf bytes.Buffer
+	opts := &RenderOptions{Columns: 2, CellSize: image.Pt(10, 20)}
+	if err := RenderSixel(&buf, input, opts); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := decodeSixel(t, buf.String())
+	if b := got.Bounds(); b.Dx() != 20 || b.Dy() != 20 {
+		t.Errorf("RenderSixel() image is %dx%d, want 20x20", b.Dx(), b.Dy())
+	}
+}
+
+// closeRGBA reports whether each channel of a and b differ by at most d.
+func closeRGBA(a, b color.RGBA, d int) bool {
+	near := func(x, y uint8) bool {
+		return max(x, y)-min(x, y) <= uint8(d)
+	}
+	return near(a.R, b.R) && near(a.G, b.G) && near(a.B, b.B) && a.A == b.A
+}
@@ -0,0 +1,121 @@
+package semigraph
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// tty is a terminal that replies to queries.
+type tty interface {
+	io.ReadWriter
+	SetReadDeadline(t time.Time) error
+}
+
+// openTTY opens the controlling terminal in raw mode. The returned function
+// restores the terminal and closes it.
+func openTTY() (*os.File, func() error, error) {
+	f, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	restore, err := makeRaw(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, func() error {
+		return errors.Join(restore(), f.Close())
+	}, nil
+}
+
+// MakeRaw puts the terminal f refers to into raw mode, so that keys can be
+// read as they are pressed without being echoed. The returned function
+// restores the previous mode. It returns an error if f isn't a terminal.
+func MakeRaw(f *os.File) (restore func() error, err error) {
+	return makeRaw(f)
+}
+
+// da1Reply matches a terminal's reply to a primary device attributes
+// query. Every terminal answers it, so it is sent after other queries to
+// tell when they have gone unanswered without waiting for a timeout.
+var da1Reply = regexp.MustCompile(`\x1b\[\?[0-9;]*c`)
+
+// query writes q followed by a primary device attributes query to t and
+// returns everything read up to and including the reply to the latter.
+func query(t tty, q string, timeout time.Duration) ([]byte, error) {
+	// The deadline is set first so that nothing is sent to a terminal
+	// whose replies can't be waited for, which would otherwise be left
+	// for the shell to read.
+	if err := t.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, fmt.Errorf("semigraph: terminal reads can't time out: %w", err)
+	}
+	defer t.SetReadDeadline(time.Time{})
+	if _, err := io.WriteString(t, q+"\x1b[c"); err != nil {
+		return nil, err
+	}
+
+	var reply []byte
+	buf := make([]byte, 256)
+	for !da1Reply.Match(reply) {
+		n, err := t.Read(buf)
+		reply = append(reply, buf[:n]...)
+		if err != nil {
+			return reply, fmt.Errorf("semigraph: reading terminal reply: %w", err)
+		}
+		if len(reply) > 4096 {
+			return reply, errors.New("semigraph: terminal reply too long")
+		}
+	}
+	return reply, nil
+}
+
+// QueryBackground asks the controlling terminal for its background color
+// with an OSC 11 query, waiting at most timeout for it to reply.
+func QueryBackground(timeout time.Duration) (Color, error) {
+	f, closeTTY, err := openTTY()
+	if err != nil {
+		return Color{}, err
+	}
+	defer closeTTY()
+	return queryBackground(f, timeout)
+}
+
+func queryBackground(t tty, timeout time.Duration) (Color, error) {
+	reply, err := query(t, "\x1b]11;?\x1b\\", timeout)
+	if err != nil {
+		return Color{}, err
+	}
+	return parseOSCColor(reply)
+}
+
+// oscColor matches the reply to an OSC 10 or 11 query, which is
+// terminated by either BEL or ST.
+var oscColor = regexp.MustCompile(`\x1b\]1[01];rgb:([0-9a-fA-F]{1,4})/([0-9a-fA-F]{1,4})/([0-9a-fA-F]{1,4})(?:\x07|\x1b\\)`)
+
+// parseOSCColor parses the color in the reply to an OSC color query. Each
+// channel has 1 to 4 hex digits which are scaled to 8 bits.
+func parseOSCColor(reply []byte) (Color, error) {
+	m := oscColor.FindSubmatch(reply)
+	if m == nil {
+		if bytes.Contains(reply, []byte("\x1b]")) {
+			return Color{}, fmt.Errorf("semigraph: malformed color reply %q", reply)
+		}
+		return Color{}, errors.New("semigraph: terminal doesn't report its colors")
+	}
+	var ch [3]uint8
+	for i, hex := range m[1:] {
+		v, err := strconv.ParseUint(string(hex), 16, 16)
+		if err != nil {
+			return Color{}, err
+		}
+		maxv := uint64(1)<<(4*len(hex)) - 1
+		ch[i] = uint8((v*0xff + maxv/2) / maxv)
+	}
+	return RGB(ch[0], ch[1], ch[2]), nil
+}
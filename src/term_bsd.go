@@ -0,0 +1,11 @@
+//go:build darwin || dragonfly || freebsd || netbsd
+
+package semigraph
+
+import "syscall"
+
+// The ioctl requests that get and set a terminal's attributes.
+const (
+	ioctlGetTermios = syscall.TIOCGETA
+	ioctlSetTermios = syscall.TIOCSETA
+)
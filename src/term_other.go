@@ -0,0 +1,24 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd
+
+package semigraph
+
+import (
+	"errors"
+	"os"
+)
+
+// terminalSize returns the size in cells of the terminal f refers to.
+func terminalSize(f *os.File) (cols, rows int, err error) {
+	return 0, 0, errors.New("semigraph: terminal size is not supported on this platform")
+}
+
+// cellPixelSize returns the size in pixels of a cell of the terminal f
+// refers to.
+func cellPixelSize(f *os.File) (w, h int, err error) {
+	return 0, 0, errors.New("semigraph: terminal size is not supported on this platform")
+}
+
+// makeRaw puts the terminal f refers to into raw mode.
+func makeRaw(f *os.File) (restore func() error, err error) {
+	return nil, errors.New("semigraph: raw mode is not supported on this platform")
+}
@@ -0,0 +1,109 @@
+package semigraph
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+// fakeTTY is a terminal that replies to anything written to it with a
+// canned response.
+type fakeTTY struct {
+	replies map[string]string
+	written bytes.Buffer
+	pending bytes.Buffer
+}
+
+func (f *fakeTTY) Write(p []byte) (int, error) {
+	f.written.Write(p)
+	for q, r := range f.replies {
+		if bytes.Contains(p, []byte(q)) {
+			f.pending.WriteString(r)
+		}
+	}
+	return len(p), nil
+}
+
+func (f *fakeTTY) Read(p []byte) (int, error) {
+	if f.pending.Len() == 0 {
+		return 0, os.ErrDeadlineExceeded
+	}
+	return f.pending.Read(p)
+}
+
+func (f *fakeTTY) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+const fakeDA1 = "\x1b[?62;22c"
+
+func TestQueryBackground(t *testing.T) {
+	testCases := []struct {
+		name    string
+		replies map[string]string
+		want    Color
+		wantErr bool
+	}{
+		{
+			name: "st_terminated",
+			replies: map[string]string{
+				"\x1b]11;?": "\x1b]11;rgb:1e1e/2020/3030\x1b\\",
+				"\x1b[c":    fakeDA1,
+			},
+			want: RGB(0x1e, 0x20, 0x30),
+		},
+		{
+			name: "bel_terminated_short",
+			replies: map[string]string{
+				"\x1b]11;?": "\x1b]11;rgb:f/8/0\x07",
+				"\x1b[c":    fakeDA1,
+			},
+			want: RGB(0xff, 0x88, 0x00),
+		},
+		{
+			name: "unsupported",
+			replies: map[string]string{
+				"\x1b[c": fakeDA1,
+			},
+			wantErr: true,
+		},
+		{
+			name:    "no_reply",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tty := &fakeTTY{replies: tc.replies}
+			got, err := queryBackground(tty, time.Second)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("queryBackground() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("queryBackground() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseHexColor(t *testing.T) {
+	testCases := []struct {
+		input   string
+		want    Color
+		wantErr bool
+	}{
+		{input: "#ff8000", want: RGB(0xff, 0x80, 0x00)},
+		{input: "102030", want: RGB(0x10, 0x20, 0x30)},
+		{input: "#f80", want: RGB(0xff, 0x88, 0x00)},
+		{input: "#ff80", wantErr: true},
+		{input: "#gg0000", wantErr: true},
+		{input: "", wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := ParseHexColor(tc.input)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("ParseHexColor(%q) = (%v, %v), want (%v, error: %v)", tc.input, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
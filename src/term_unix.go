@@ -0,0 +1,66 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd
+
+package semigraph
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// terminalSize returns the size in cells of the terminal f refers to.
+func terminalSize(f *os.File) (cols, rows int, err error) {
+	var ws struct {
+		Row, Col, Xpixel, Ypixel uint16
+	}
+	if err := ioctl(f.Fd(), syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return 0, 0, err
+	}
+	return int(ws.Col), int(ws.Row), nil
+}
+
+// cellPixelSize returns the size in pixels of a cell of the terminal f
+// refers to, if it reports one.
+func cellPixelSize(f *os.File) (w, h int, err error) {
+	var ws struct {
+		Row, Col, Xpixel, Ypixel uint16
+	}
+	if err := ioctl(f.Fd(), syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return 0, 0, err
+	}
+	if ws.Xpixel == 0 || ws.Ypixel == 0 || ws.Col == 0 || ws.Row == 0 {
+		return 0, 0, errors.New("semigraph: terminal didn't report its size in pixels")
+	}
+	return int(ws.Xpixel / ws.Col), int(ws.Ypixel / ws.Row), nil
+}
+
+// makeRaw puts the terminal f refers to into raw mode so that replies to
+// queries can be read without waiting for a newline or being echoed. The
+// returned function restores the previous mode.
+func makeRaw(f *os.File) (restore func() error, err error) {
+	var old syscall.Termios
+	if err := ioctl(f.Fd(), ioctlGetTermios, unsafe.Pointer(&old)); err != nil {
+		return nil, err
+	}
+	raw := old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(f.Fd(), ioctlSetTermios, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+	return func() error {
+		return ioctl(f.Fd(), ioctlSetTermios, unsafe.Pointer(&old))
+	}, nil
+}
+
+func ioctl(fd, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
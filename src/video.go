@@ -0,0 +1,247 @@
+package semigraph
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxFramePixels bounds the size of video frames, so a corrupt header or
+// a mistyped size can't make a source allocate an unreasonable amount of
+// memory. It is well above the 33 million pixels of 8K video.
+const maxFramePixels = 1 << 26
+
+// checkFrameSize returns an error if a video frame of width x height
+// pixels is empty or too big to read.
+func checkFrameSize(width, height int) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("semigraph: invalid video size %dx%d", width, height)
+	}
+	if width > maxFramePixels/height {
+		return fmt.Errorf("semigraph: video size %dx%d is too large", width, height)
+	}
+	return nil
+}
+
+// videoSource is a FrameSource for a stream of uncompressed video frames.
+// Every frame covers the whole canvas and is shown once.
+type videoSource struct {
+	width, height int
+	delay         time.Duration
+	read          func() (image.Image, error)
+}
+
+func (s *videoSource) Size() (width, height int) {
+	return s.width, s.height
+}
+
+func (s *videoSource) LoopCount() int {
+	return -1
+}
+
+func (s *videoSource) NextFrame() (Frame, error) {
+	img, err := s.read()
+	if err != nil {
+		return Frame{}, err
+	}
+	return Frame{Image: img, Delay: s.delay, Op: draw.Src}, nil
+}
+
+// NewRawVideoSource returns a [FrameSource] for a stream of raw RGB video
+// frames read from r, each width x height pixels of 3 bytes, shown at fps
+// frames per second. This is the output of
+//
+//	ffmpeg -i <input> -f rawvideo -pix_fmt rgb24 -
+func NewRawVideoSource(r io.Reader, width, height int, fps float64) (FrameSource, error) {
+	if err := checkFrameSize(width, height); err != nil {
+		return nil, err
+	}
+	if !(fps > 0) {
+		return nil, fmt.Errorf("semigraph: invalid frame rate %v", fps)
+	}
+	rgb := make([]byte, width*height*3)
+	return &videoSource{
+		width:  width,
+		height: height,
+		delay:  time.Duration(float64(time.Second) / fps),
+		read: func() (image.Image, error) {
+			if err := readFrame(r, rgb); err != nil {
+				return nil, err
+			}
+			img := image.NewRGBA(image.Rect(0, 0, width, height))
+			for i, j := 0, 0; i < len(rgb); i, j = i+3, j+4 {
+				img.Pix[j+0] = rgb[i+0]
+				img.Pix[j+1] = rgb[i+1]
+				img.Pix[j+2] = rgb[i+2]
+				img.Pix[j+3] = 0xff
+			}
+			return img, nil
+		},
+	}, nil
+}
+
+// readFrame fills buf with the next frame from r. It returns io.EOF if
+// there are no more frames.
+func readFrame(r io.Reader, buf []byte) error {
+	n, err := io.ReadFull(r, buf)
+	switch {
+	case err == io.EOF:
+		return io.EOF
+	case err == io.ErrUnexpectedEOF:
+		return fmt.Errorf("semigraph: video frame truncated after %d of %d bytes", n, len(buf))
+	}
+	return err
+}
+
+// NewY4MSource returns a [FrameSource] for a YUV4MPEG2 stream read from r,
+// such as the output of
+//
+//	ffmpeg -i <input> -f yuv4mpegpipe -
+//
+// 8-bit 4:2:0, 4:2:2, 4:4:4 and monochrome streams are supported. The
+// colors are assumed to be limited range BT.601, unless the stream says
+// they are full range.
+func NewY4MSource(r io.Reader) (FrameSource, error) {
+	br := bufio.NewReader(r)
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("semigraph: reading Y4M header: %w", err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != "YUV4MPEG2" {
+		return nil, errors.New("semigraph: not a Y4M stream")
+	}
+	var (
+		w, h     int
+		num, den = 25, 1
+		cs       = "420jpeg"
+		full     bool
+	)
+	for _, f := range fields[1:] {
+		v := f[1:]
+		switch f[0] {
+		case 'W':
+			w, err = strconv.Atoi(v)
+		case 'H':
+			h, err = strconv.Atoi(v)
+		case 'F':
+			num, den, err = parseRatio(v)
+		case 'C':
+			cs = v
+		case 'X':
+			full = v == "COLORRANGE=FULL"
+		}
+		if err != nil {
+			return nil, fmt.Errorf("semigraph: invalid Y4M header field %q", f)
+		}
+	}
+	if w == 0 || h == 0 {
+		return nil, errors.New("semigraph: Y4M header is missing the frame size")
+	}
+	if err := checkFrameSize(w, h); err != nil {
+		return nil, err
+	}
+	if num <= 0 || den <= 0 {
+		return nil, errors.New("semigraph: invalid Y4M frame rate")
+	}
+
+	var ratio image.YCbCrSubsampleRatio
+	mono := false
+	switch cs {
+	case "420jpeg", "420paldv", "420mpeg2", "420":
+		ratio = image.YCbCrSubsampleRatio420
+	case "422":
+		ratio = image.YCbCrSubsampleRatio422
+	case "444":
+		ratio = image.YCbCrSubsampleRatio444
+	case "mono":
+		mono = true
+	default:
+		return nil, fmt.Errorf("semigraph: unsupported Y4M colorspace %q", cs)
+	}
+	bounds := image.Rect(0, 0, w, h)
+	// The planes are read straight into an image of the right layout.
+	ycc := image.NewYCbCr(bounds, ratio)
+	frameBuf := ycc.Y
+	if mono {
+		for i := range ycc.Cb {
+			ycc.Cb[i], ycc.Cr[i] = 0x80, 0x80
+		}
+	} else {
+		frameBuf = make([]byte, len(ycc.Y)+len(ycc.Cb)+len(ycc.Cr))
+	}
+	return &videoSource{
+		width:  w,
+		height: h,
+		delay:  time.Second * time.Duration(den) / time.Duration(num),
+		read: func() (image.Image, error) {
+			line, err := br.ReadString('\n')
+			if err == io.EOF && line == "" {
+				return nil, io.EOF
+			}
+			if err != nil || !strings.HasPrefix(line, "FRAME") {
+				return nil, errors.New("semigraph: invalid Y4M frame header")
+			}
+			if err := readFrame(br, frameBuf); err != nil {
+				if err == io.EOF {
+					err = errors.New("semigraph: Y4M frame has no data")
+				}
+				return nil, err
+			}
+			if !mono {
+				n, m := len(ycc.Y), len(ycc.Cb)
+				copy(ycc.Y, frameBuf[:n])
+				copy(ycc.Cb, frameBuf[n:n+m])
+				copy(ycc.Cr, frameBuf[n+m:])
+			}
+			return yccToRGBA(ycc, full), nil
+		},
+	}, nil
+}
+
+// parseRatio parses a ratio in the form n:d.
+func parseRatio(s string) (n, d int, err error) {
+	ns, ds, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, errors.New("missing colon")
+	}
+	if n, err = strconv.Atoi(ns); err != nil {
+		return 0, 0, err
+	}
+	d, err = strconv.Atoi(ds)
+	return n, d, err
+}
+
+// yccToRGBA converts a BT.601 image to RGB. Limited range images have
+// luma in [16, 235] and chroma in [16, 240].
+func yccToRGBA(p *image.YCbCr, full bool) *image.RGBA {
+	if full {
+		// The standard library's conversion is for full range JPEG images.
+		img := image.NewRGBA(p.Rect)
+		draw.Draw(img, img.Rect, p, p.Rect.Min, draw.Src)
+		return img
+	}
+	img := image.NewRGBA(p.Rect)
+	clamp := func(v float64) uint8 {
+		return uint8(min(max(v+0.5, 0), 255))
+	}
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		for x := p.Rect.Min.X; x < p.Rect.Max.X; x++ {
+			yy := 1.164 * (float64(p.Y[p.YOffset(x, y)]) - 16)
+			cb := float64(p.Cb[p.COffset(x, y)]) - 128
+			cr := float64(p.Cr[p.COffset(x, y)]) - 128
+			i := img.PixOffset(x, y)
+			img.Pix[i+0] = clamp(yy + 1.596*cr)
+			img.Pix[i+1] = clamp(yy - 0.392*cb - 0.813*cr)
+			img.Pix[i+2] = clamp(yy + 2.017*cb)
+			img.Pix[i+3] = 0xff
+		}
+	}
+	return img
+}
@@ -0,0 +1,109 @@
+package semigraph
+
+import (
+	"bytes"
+	"image/color"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRawVideoSource(t *testing.T) {
+	// Two 2x1 frames: red and green, then blue and white.
+	data := []byte{
+		0xff, 0x00, 0x00, 0x00, 0xff, 0x00,
+		0x00, 0x00, 0xff, 0xff, 0xff, 0xff,
+	}
+	src, err := NewRawVideoSource(bytes.NewReader(data), 2, 1, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := compositeSource(t, src)
+	if want := []string{"RG", "BW"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("compositeFrames() = %q, want %q", got, want)
+	}
+
+	src, err = NewRawVideoSource(bytes.NewReader(data[:9]), 2, 1, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.NextFrame(); err != nil {
+		t.Fatalf("NextFrame() returned unexpected error: %v", err)
+	}
+	if _, err := src.NextFrame(); err == nil || err == io.EOF {
+		t.Errorf("NextFrame() on a truncated frame returned %v, want an error", err)
+	}
+}
+
+func TestRawVideoSourceInvalid(t *testing.T) {
+	testCases := []struct {
+		width, height int
+		fps           float64
+	}{
+		{0, 1, 25},
+		{2, -1, 25},
+		{100000, 100000, 25},
+		{2, 1, 0},
+	}
+	for _, tc := range testCases {
+		if _, err := NewRawVideoSource(bytes.NewReader(nil), tc.width, tc.height, tc.fps); err == nil {
+			t.Errorf("NewRawVideoSource(%d, %d, %v) returned nil error", tc.width, tc.height, tc.fps)
+		}
+	}
+}
+
+func TestY4MSource(t *testing.T) {
+	// A 2x2 4:2:0 stream with one chroma sample per frame.
+	stream := "YUV4MPEG2 W2 H2 F30000:1001 Ip A1:1 C420jpeg\n" +
+		"FRAME\n" + "\x10\x10\x10\x10" + "\x80" + "\x80" +
+		"FRAME Ixyz\n" + "\xeb\xeb\xeb\xeb" + "\x80" + "\x80"
+	src, err := NewY4MSource(strings.NewReader(stream))
+	if err != nil {
+		t.Fatalf("NewY4MSource() returned unexpected error: %v", err)
+	}
+	if w, h := src.Size(); w != 2 || h != 2 {
+		t.Errorf("Size() = %d, %d, want 2, 2", w, h)
+	}
+	var frames []Frame
+	for {
+		f, err := src.NextFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextFrame() returned unexpected error: %v", err)
+		}
+		frames = append(frames, f)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("read %d frames, want 2", len(frames))
+	}
+	// Limited range black and white.
+	wantColors := []color.RGBA{{0, 0, 0, 0xff}, {0xff, 0xff, 0xff, 0xff}}
+	for i, f := range frames {
+		if got := color.RGBAModel.Convert(f.Image.At(1, 1)); got != wantColors[i] {
+			t.Errorf("frame %d is %v, want %v", i, got, wantColors[i])
+		}
+		if want := 33366666 * time.Nanosecond; f.Delay != want {
+			t.Errorf("frame %d has delay %v, want %v", i, f.Delay, want)
+		}
+	}
+}
+
+func TestY4MSourceInvalid(t *testing.T) {
+	testCases := []string{
+		"",
+		"P6\n2 2\n255\n",
+		"YUV4MPEG2 W2\n",
+		"YUV4MPEG2 W2 H2 C420p10\n",
+		"YUV4MPEG2 W2 H2 Fx\n",
+		"YUV4MPEG2 W-2 H2\n",
+		"YUV4MPEG2 W100000 H100000\n",
+	}
+	for _, tc := range testCases {
+		if _, err := NewY4MSource(strings.NewReader(tc)); err == nil {
+			t.Errorf("NewY4MSource(%q) returned nil error", tc)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package semigraph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"time"
+
+	"golang.org/x/image/webp"
+)
+
+// webpSource is a FrameSource for the frames of an animated WebP.
+type webpSource struct {
+	width, height int
+	plays         int
+
+	frames []webpFrame
+	next   int
+}
+
+// webpFrame is an ANMF chunk: where a frame goes and the encoded chunks of
+// its image.
+type webpFrame struct {
+	x, y, width, height int
+	delay               time.Duration
+	blend, dispose      bool
+
+	// alpha is set if data has an ALPH chunk for a lossy image, which has
+	// to be declared in a VP8X chunk to be decoded.
+	alpha bool
+	data  []byte
+}
+
+// DecodeWebP reads an animated WebP from r and returns a [FrameSource] for
+// its frames. Each frame is decoded with [webp.Decode] when it is read.
+//
+// It returns [ErrNotAnimated] if the WebP doesn't have the animation flag
+// set in its extended header.
+func DecodeWebP(r io.Reader) (FrameSource, error) {
+	br := bufio.NewReader(r)
+	var hdr [12]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil || string(hdr[0:4]) != "RIFF" || string(hdr[8:12]) != "WEBP" {
+		return nil, errors.New("semigraph: not a WebP file")
+	}
+	// The RIFF size isn't trusted. The chunks are read until the end of
+	// the file instead.
+	s := &webpSource{}
+	animated := false
+	for {
+		typ, data, err := readRIFFChunk(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("semigraph: reading WebP: %w", err)
+		}
+		switch typ {
+		case "VP8X":
+			if len(data) < 10 {
+				return nil, errors.New("semigraph: invalid WebP header")
+			}
+			animated = data[0]&0x02 != 0
+			s.width = int(le24(data[4:])) + 1
+			s.height = int(le24(data[7:])) + 1
+		case "ANIM":
+			if len(data) < 6 {
+				return nil, errors.New("semigraph: invalid WebP animation chunk")
+			}
+			// The background color is only a hint, and is ignored like
+			// browsers do so the canvas starts out transparent.
+			s.plays = int(binary.LittleEndian.Uint16(data[4:6]))
+		case "ANMF":
+			f, err := s.parseFrame(data)
+			if err != nil {
+				return nil, err
+			}
+			s.frames = append(s.frames, f)
+		}
+	}
+	if !animated {
+		return nil, ErrNotAnimated
+	}
+	if len(s.frames) == 0 {
+		return nil, errors.New("semigraph: WebP has no frames")
+	}
+	return s, nil
+}
+
+// parseFrame parses the data of an ANMF chunk.
+func (s *webpSource) parseFrame(data []byte) (webpFrame, error) {
+	if len(data) < 16 {
+		return webpFrame{}, errors.New("semigraph: invalid WebP frame chunk")
+	}
+	f := webpFrame{
+		// Offsets are stored halved.
+		x:       int(le24(data[0:])) * 2,
+		y:       int(le24(data[3:])) * 2,
+		width:   int(le24(data[6:])) + 1,
+		height:  int(le24(data[9:])) + 1,
+		delay:   time.Duration(le24(data[12:])) * time.Millisecond,
+		blend:   data[15]&0x02 == 0,
+		dispose: data[15]&0x01 != 0,
+	}
+	if f.x+f.width > s.width || f.y+f.height > s.height {
+		return webpFrame{}, errors.New("semigraph: WebP frame is outside the canvas")
+	}
+	// Only the chunks of the image are kept. Unknown chunks may follow it.
+	r := bytes.NewReader(data[16:])
+	for {
+		typ, chunk, err := readRIFFChunk(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return webpFrame{}, fmt.Errorf("semigraph: reading WebP frame: %w", err)
+		}
+		switch typ {
+		case "ALPH":
+			f.alpha = true
+			f.data = appendRIFFChunk(f.data, typ, chunk)
+		case "VP8 ", "VP8L":
+			f.data = appendRIFFChunk(f.data, typ, chunk)
+		}
+	}
+	if len(f.data) == 0 {
+		return webpFrame{}, errors.New("semigraph: WebP frame has no image")
+	}
+	return f, nil
+}
+
+func (s *webpSource) Size() (width, height int) {
+	return s.width, s.height
+}
+
+func (s *webpSource) LoopCount() int {
+	// Like APNG, WebP counts the number of times the animation is played,
+	// with 0 meaning forever.
+	if s.plays == 0 {
+		return 0
+	}
+	return s.plays - 1
+}
+
+func (s *webpSource) NextFrame() (Frame, error) {
+	if s.next >= len(s.frames) {
+		return Frame{}, io.EOF
+	}
+	wf := s.frames[s.next]
+	s.next++
+
+	// Each frame is decoded as a WebP of its own.
+	buf := []byte("RIFF\x00\x00\x00\x00WEBP")
+	if wf.alpha {
+		vp8x := make([]byte, 10)
+		vp8x[0] = 0x10 // Alpha.
+		putLE24(vp8x[4:], uint32(wf.width-1))
+		putLE24(vp8x[7:], uint32(wf.height-1))
+		buf = appendRIFFChunk(buf, "VP8X", vp8x)
+	}
+	buf = append(buf, wf.data...)
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(len(buf)-8))
+	img, err := webp.Decode(bytes.NewReader(buf))
+	if err != nil {
+		return Frame{}, fmt.Errorf("semigraph: decoding WebP frame %d: %w", s.next-1, err)
+	}
+	if b := img.Bounds(); b.Dx() != wf.width || b.Dy() != wf.height {
+		return Frame{}, fmt.Errorf("semigraph: WebP frame %d is %dx%d, want %dx%d", s.next-1, b.Dx(), b.Dy(), wf.width, wf.height)
+	}
+
+	f := Frame{
+		Image: translate(img, image.Pt(wf.x, wf.y)),
+		Delay: wf.delay,
+		Op:    draw.Src,
+	}
+	if wf.blend {
+		f.Op = draw.Over
+	}
+	if wf.dispose {
+		f.Disposal = DisposalBackground
+	}
+	return f, nil
+}
+
+// readRIFFChunk reads the next RIFF chunk from r, skipping the padding
+// byte after chunks of odd length. It returns io.EOF if there are no more
+// chunks.
+func readRIFFChunk(r io.Reader) (typ string, data []byte, err error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errors.New("truncated chunk header")
+		}
+		return "", nil, err
+	}
+	n := int64(binary.LittleEndian.Uint32(hdr[4:]))
+	// Reading through a LimitReader only allocates as much as is there, so
+	// a corrupt size can't allocate gigabytes.
+	data, err = io.ReadAll(io.LimitReader(r, n+n%2))
+	if err != nil {
+		return "", nil, err
+	}
+	if int64(len(data)) < n {
+		return "", nil, fmt.Errorf("%q chunk truncated", hdr[:4])
+	}
+	return string(hdr[:4]), data[:n], nil
+}
+
+// appendRIFFChunk appends a RIFF chunk to buf, padded to an even length.
+func appendRIFFChunk(buf []byte, typ string, data []byte) []byte {
+	buf = append(buf, typ...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(data)))
+	buf = append(buf, data...)
+	if len(data)%2 == 1 {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+// le24 returns the 24-bit little endian number at the start of b.
+func le24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+// putLE24 stores v as a 24-bit little endian number at the start of b.
+func putLE24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
@@ -0,0 +1,179 @@
+package semigraph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+	"time"
+)
+
+// encodeVP8L returns a lossless WebP bitstream of a w x h image filled
+// with c. Every prefix code has a single symbol, so the pixels themselves
+// take no bits at all.
+func encodeVP8L(w, h int, c color.NRGBA) []byte {
+	var (
+		out  []byte
+		acc  uint64
+		nacc uint
+	)
+	put := func(v uint64, n uint) {
+		acc |= v << nacc
+		nacc += n
+		for nacc >= 8 {
+			out = append(out, byte(acc))
+			acc >>= 8
+			nacc -= 8
+		}
+	}
+	put(0x2f, 8)
+	put(uint64(w-1), 14)
+	put(uint64(h-1), 14)
+	put(1, 1) // Alpha is used.
+	put(0, 3) // Version.
+	put(0, 1) // No transforms.
+	put(0, 1) // No color cache.
+	put(0, 1) // No meta prefix codes.
+	// The green, red, blue, alpha and distance codes.
+	for _, sym := range []uint8{c.G, c.R, c.B, c.A, 0} {
+		put(1, 1) // A simple code,
+		put(0, 1) // of one symbol,
+		put(1, 1) // of 8 bits.
+		put(uint64(sym), 8)
+	}
+	if nacc > 0 {
+		out = append(out, byte(acc))
+	}
+	return out
+}
+
+// webpFrameSpec is a frame of a test WebP filled with a single color.
+type webpFrameSpec struct {
+	rect           image.Rectangle
+	c              color.NRGBA
+	noBlend, clear bool
+}
+
+// encodeWebP returns an animated WebP of the frames on a 4x4 canvas, each
+// shown for 100ms.
+func encodeWebP(plays uint16, frames []webpFrameSpec) []byte {
+	vp8x := make([]byte, 10)
+	vp8x[0] = 0x02 | 0x10 // Animation and alpha.
+	putLE24(vp8x[4:], 3)
+	putLE24(vp8x[7:], 3)
+	anim := binary.LittleEndian.AppendUint32(nil, 0xffffffff)
+	anim = binary.LittleEndian.AppendUint16(anim, plays)
+
+	buf := []byte("RIFF\x00\x00\x00\x00WEBP")
+	buf = appendRIFFChunk(buf, "VP8X", vp8x)
+	buf = appendRIFFChunk(buf, "ANIM", anim)
+	for _, f := range frames {
+		anmf := make([]byte, 16)
+		putLE24(anmf[0:], uint32(f.rect.Min.X/2))
+		putLE24(anmf[3:], uint32(f.rect.Min.Y/2))
+		putLE24(anmf[6:], uint32(f.rect.Dx()-1))
+		putLE24(anmf[9:], uint32(f.rect.Dy()-1))
+		putLE24(anmf[12:], 100)
+		if f.noBlend {
+			anmf[15] |= 0x02
+		}
+		if f.clear {
+			anmf[15] |= 0x01
+		}
+		anmf = appendRIFFChunk(anmf, "VP8L", encodeVP8L(f.rect.Dx(), f.rect.Dy(), f.c))
+		buf = appendRIFFChunk(buf, "ANMF", anmf)
+	}
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(len(buf)-8))
+	return buf
+}
+
+func TestDecodeWebP(t *testing.T) {
+	red := color.NRGBA{0xff, 0x00, 0x00, 0xff}
+	green := color.NRGBA{0x00, 0xff, 0x00, 0xff}
+	blue := color.NRGBA{0x00, 0x00, 0xff, 0xff}
+	data := encodeWebP(3, []webpFrameSpec{
+		{rect: image.Rect(0, 0, 4, 4), c: red},
+		// Blended over the red frame, so nothing changes.
+		{rect: image.Rect(2, 2, 4, 4), c: color.NRGBA{}},
+		// Cleared to transparent afterwards.
+		{rect: image.Rect(0, 0, 2, 2), c: blue, clear: true},
+		// Replaces the canvas with transparent pixels.
+		{rect: image.Rect(2, 0, 4, 2), c: color.NRGBA{}, noBlend: true},
+		{rect: image.Rect(0, 2, 2, 4), c: green},
+	})
+
+	src, err := DecodeWebP(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeWebP() returned unexpected error: %v", err)
+	}
+	if w, h := src.Size(); w != 4 || h != 4 {
+		t.Errorf("Size() = %d, %d, want 4, 4", w, h)
+	}
+	if got := src.LoopCount(); got != 2 {
+		t.Errorf("LoopCount() = %d, want 2", got)
+	}
+	got := compositeSource(t, src)
+	want := []string{
+		"RRRR RRRR RRRR RRRR",
+		"RRRR RRRR RRRR RRRR",
+		"BBRR BBRR RRRR RRRR",
+		".... .... RRRR RRRR",
+		".... .... GGRR GGRR",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("compositeFrames() returned unexpected canvases:\ngot:  %q\nwant: %q", got, want)
+	}
+
+	g, err := RenderFrames(must(DecodeWebP(bytes.NewReader(data))), nil)
+	if err != nil {
+		t.Fatalf("RenderFrames() returned unexpected error: %v", err)
+	}
+	for i, f := range g.frames {
+		if f.delay != 100*time.Millisecond {
+			t.Errorf("frame %d has delay %v, want 100ms", i, f.delay)
+		}
+	}
+}
+
+func TestDecodeWebPNotAnimated(t *testing.T) {
+	data := appendRIFFChunk([]byte("RIFF\x00\x00\x00\x00WEBP"), "VP8L", encodeVP8L(2, 2, color.NRGBA{A: 0xff}))
+	if _, err := DecodeWebP(bytes.NewReader(data)); !errors.Is(err, ErrNotAnimated) {
+		t.Errorf("DecodeWebP() returned error %v, want ErrNotAnimated", err)
+	}
+}
+
+func TestDecodeWebPInvalid(t *testing.T) {
+	data := encodeWebP(0, []webpFrameSpec{
+		{rect: image.Rect(0, 0, 4, 4)},
+	})
+	testCases := map[string][]byte{
+		"not_webp":  []byte("GIF89a"),
+		"truncated": data[:len(data)-4],
+		"no_frames": encodeWebP(0, nil),
+		"frame_outside_canvas": encodeWebP(0, []webpFrameSpec{
+			{rect: image.Rect(2, 2, 6, 6)},
+		}),
+	}
+	for name, data := range testCases {
+		if _, err := DecodeWebP(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: DecodeWebP() returned nil error", name)
+		}
+	}
+
+	// A frame whose image doesn't match its size is only found when it is
+	// decoded.
+	data = encodeWebP(0, []webpFrameSpec{
+		{rect: image.Rect(0, 0, 4, 4)},
+	})
+	copy(data[bytes.Index(data, []byte("VP8L"))+8:], encodeVP8L(2, 2, color.NRGBA{}))
+	src, err := DecodeWebP(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeWebP() returned unexpected error: %v", err)
+	}
+	if _, err := src.NextFrame(); err == nil {
+		t.Error("NextFrame() of a frame of the wrong size returned nil error")
+	}
+}